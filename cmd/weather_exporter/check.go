@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+// checkConfig reads every setting without starting the exporter, and reports anything that would
+// leave it misconfigured. It returns the exit code: 0 if the configuration is usable, or 1 if not.
+func checkConfig() int {
+	// Problems are printed below, so anything logged while reading the settings is only noise
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	api.ResetConfigProblems()
+
+	problems := make([]string, 0)
+	if configPath := api.GetStringWithDefault("WEX_CONFIG_FILE", ""); configPath != "" {
+		if err := api.LoadConfigFile(configPath); err != nil {
+			problems = append(problems, fmt.Sprintf("WEX_CONFIG_FILE: unable to load configuration file: %v", err))
+		}
+	}
+	if _, err := logLevel("info"); err != nil {
+		problems = append(problems, fmt.Sprintf("WEX_LOG_LEVEL: %v", err))
+	}
+	api.GetStringWithDefault("WEX_BIND_ADDR", DefaultAddress)
+	bearerToken := api.GetSecret("WEX_WEB_BEARER_TOKEN")
+	api.GetDurationWithDefault("WEX_SHUTDOWN_TIMEOUT", DefaultShutdownWait)
+	api.GetUnits()
+	if _, err := metricsSchema(); err != nil {
+		problems = append(problems, fmt.Sprintf("WEX_METRICS_SCHEMA: %v", err))
+	}
+	webConfig := api.GetStringWithDefault("WEX_WEB_CONFIG_FILE", "")
+	if err := web.Validate(webConfig); err != nil {
+		problems = append(problems, fmt.Sprintf("WEX_WEB_CONFIG_FILE: %v", err))
+	} else if err := checkWebAuth(webConfig, bearerToken); err != nil {
+		problems = append(problems, fmt.Sprintf("WEX_WEB_CONFIG_FILE: %v", err))
+	}
+	api.GetDurationWithDefault("WEX_CONFIG_WATCH", DefaultConfigWatch)
+
+	client, _, err := newClient(false)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("WEX_CACHE_DIR: unable to create cache: %v", err))
+	}
+	apis := api.BuildAll(client)
+
+	for _, p := range api.ConfigProblems() {
+		problems = append(problems, p.Error())
+	}
+	if len(apis) == 0 {
+		problems = append(problems, "no locations are configured, so no weather would be reported")
+	}
+	for _, env := range api.UnknownSettings() {
+		problems = append(problems, fmt.Sprintf("%s: unknown setting, which may be a typo", env))
+	}
+
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Printf("Configuration OK, %d location(s) configured\n", len(apis))
+	return 0
+}
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
-	rtcache "github.com/ArthurHlt/go-roundtripper-cache"
 	"github.com/gca3020/weather_exporter/internal/api"
+	"github.com/gca3020/weather_exporter/internal/cache"
 	"github.com/gca3020/weather_exporter/internal/exporter"
+	"github.com/gca3020/weather_exporter/internal/redact"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 )
 
 var (
@@ -20,36 +26,194 @@ var (
 )
 
 const (
-	DefaultAddress = ":9265"
-	DefaultTTL     = 10 * time.Minute
+	DefaultAddress      = ":9265"
+	DefaultTTL          = 10 * time.Minute
+	DefaultMaxTTL       = 1 * time.Hour
+	DefaultCacheSizeMiB = 64
+	DefaultHTTPTimeout  = 30 * time.Second
+	DefaultConfigWatch  = 30 * time.Second
+	DefaultShutdownWait = 30 * time.Second
+	QuotaSaveInterval   = 1 * time.Minute
 
-	Endpoint = "/metrics"
+	Endpoint           = "/metrics"
+	ConditionsEndpoint = "/api/v1/conditions"
 )
 
 func main() {
-	// Create the default logger using logfmt
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check-config":
+			os.Exit(checkConfig())
+		case "query":
+			os.Exit(query(os.Args[2:]))
+		default:
+			fmt.Fprintf(os.Stderr, "usage: %s [check-config | query --provider KEY --lat LAT --lon LON]\n", filepath.Base(os.Args[0]))
+			os.Exit(2)
+		}
+	}
+
+	// Settings may be given in a config file as well as the environment. This is loaded before
+	// anything else, since it may contain any of the other settings.
+	configPath := api.GetStringWithDefault("WEX_CONFIG_FILE", "")
+	var configErr error
+	if configPath != "" {
+		configErr = api.LoadConfigFile(configPath)
+	}
+
+	// Create the default logger using logfmt, scrubbing any API keys from what gets logged
+	level, levelErr := logLevel("info")
+	slog.SetDefault(slog.New(redact.NewHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))))
 	slog.Info("Starting Application", "name", filepath.Base(os.Args[0]), "release", Release, "git", SHA)
+	if configErr != nil {
+		slog.Error("Unable to load configuration file", "path", configPath, "err", configErr)
+		os.Exit(1)
+	}
+	if levelErr != nil {
+		slog.Error("Invalid configuration", "env", "WEX_LOG_LEVEL", "problem", levelErr)
+	}
 
 	// Get the default parameters that apply to the entire application
 	addr := api.GetStringWithDefault("WEX_BIND_ADDR", DefaultAddress)
+	webConfig := api.GetStringWithDefault("WEX_WEB_CONFIG_FILE", "")
+	bearerToken := api.GetSecret("WEX_WEB_BEARER_TOKEN")
+	shutdownWait := api.GetDurationWithDefault("WEX_SHUTDOWN_TIMEOUT", DefaultShutdownWait)
+	if err := checkWebAuth(webConfig, bearerToken); err != nil {
+		slog.Error("Invalid configuration", "env", "WEX_WEB_CONFIG_FILE", "problem", err)
+		os.Exit(1)
+	}
+	configWatch := api.GetDurationWithDefault("WEX_CONFIG_WATCH", DefaultConfigWatch)
+	units := api.GetUnits()
+	schema, err := metricsSchema()
+	if err != nil {
+		slog.Error("Invalid configuration", "env", "WEX_METRICS_SCHEMA", "problem", err)
+	}
 
-	// Set up the local client cache with a 10 minute TTL
-	ttl := api.GetDurationWithDefault("WEX_TTL", DefaultTTL)
-	client := &http.Client{
-		Transport: rtcache.NewRoundTripperCache(ttl),
+	client, quota, err := newClient(true)
+	if err != nil {
+		slog.Error("Unable to create cache", "err", err)
+		os.Exit(1)
 	}
 
-	// Build all the APIs
+	// Build all the APIs, warning about anything that looks like a mistake in the configuration,
+	// since it would otherwise go unnoticed until the metrics are missing.
 	apis := api.BuildAll(client)
+	if len(apis) == 0 {
+		slog.Warn("No locations are configured, so no weather will be reported")
+	}
+	// Settings which are not recognized are usually typos, and would otherwise be silently ignored
+	for _, env := range api.UnknownSettings() {
+		slog.Warn("Unknown setting, which may be a typo", "env", env)
+	}
 
-	// Register the API with the collector and the collector with prometheus.
-	prometheus.MustRegister(exporter.NewCollector(apis))
-	http.Handle(Endpoint, promhttp.Handler())
+	// Register the API with the collector, which is bound to each scrape alongside the default
+	// prometheus metrics, so that the providers are queried within the scrape's context.
+	collector := exporter.NewCollector(apis, units, schema)
+	handler := exporter.NewHandler(collector, prometheus.DefaultGatherer)
+	go watchConfig(configPath, configWatch, client, collector)
+	http.Handle(Endpoint, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handler))
+	http.Handle(ConditionsEndpoint, exporter.NewConditionsHandler(collector))
+	http.Handle("/", exporter.NewLandingHandler(collector, Endpoint, ConditionsEndpoint))
+	http.Handle("/-/healthy", exporter.NewHealthyHandler())
+	http.Handle("/-/ready", exporter.NewReadyHandler(collector))
+
+	// Poll every target in the background, so that the exporter becomes ready without waiting for
+	// the first scrape.
+	primeCtx, cancelPrime := context.WithCancel(context.Background())
+	primed := make(chan struct{})
+	go func() {
+		defer close(primed)
+		collector.Prime(primeCtx)
+	}()
+
+	// Begin serving until asked to stop. TLS and basic auth are enabled by a web config file, in the
+	// same format as other Prometheus exporters.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go quota.Persist(ctx, QuotaSaveInterval)
+	server := &http.Server{Handler: requireBearerToken(bearerToken, http.DefaultServeMux)}
+	served := make(chan error, 1)
+	go func() {
+		served <- web.ListenAndServe(server, &web.FlagConfig{
+			WebListenAddresses: &[]string{addr},
+			WebConfigFile:      &webConfig,
+		}, kitLogger{slog.Default()})
+	}()
 	slog.Info("started serving", "addr", addr, "endpoint", Endpoint)
 
-	// Begin serving, which will block forever
-	err := http.ListenAndServe(addr, nil)
-	slog.Error("ListenAndServe terminated", "err", err)
-	os.Exit(1)
+	select {
+	case err := <-served:
+		slog.Error("ListenAndServe terminated", "err", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	// Stop accepting new connections, and give the scrapes in progress (and the provider requests
+	// they are waiting on) a chance to finish before exiting.
+	stop()
+	slog.Info("Shutting down", "timeout", shutdownWait)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownWait)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	select {
+	case <-primed:
+	case <-shutdownCtx.Done():
+	}
+	cancelPrime()
+	quota.Save()
+	if err != nil {
+		slog.Error("Scrapes still in progress were abandoned", "err", err)
+		os.Exit(1)
+	}
+	slog.Info("Shutdown complete")
+}
+
+// logLevel returns the minimum level of messages to log, falling back to the given default if the
+// setting is invalid
+func logLevel(defaultVal string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(api.GetStringWithDefault("WEX_LOG_LEVEL", defaultVal))); err != nil {
+		_ = level.UnmarshalText([]byte(defaultVal))
+		return level, err
+	}
+	return level, nil
+}
+
+// metricsSchema returns the set of metric names to report, defaulting to v1 if the setting is invalid
+func metricsSchema() (exporter.Schema, error) {
+	return exporter.ParseSchema(api.GetStringWithDefault("WEX_METRICS_SCHEMA", "v1"))
+}
+
+// newClient creates the HTTP client used for all provider requests, along with the transport which
+// keeps them within each provider's quota. The quotas are only persisted if persist is set, so that
+// the one-shot commands do not overwrite the state of an exporter running alongside them.
+func newClient(persist bool) (*http.Client, *api.QuotaTransport, error) {
+	// Set up the local client cache, which follows the providers' caching headers where they are
+	// present and falls back to WEX_TTL otherwise. By default WEX_TTL is also the floor, so that the
+	// headers can only make a provider polled less often, never more. This is optionally persisted
+	// to disk. Requests which miss the cache are retried on temporary failures, and count towards
+	// each provider's quota, which is persisted alongside the cache. Those which are actually sent
+	// are timed.
+	cacheDir := api.GetStringWithDefault("WEX_CACHE_DIR", "")
+	ttl := api.GetDurationWithDefault("WEX_TTL", DefaultTTL)
+	stateFile := ""
+	if persist {
+		stateFile = api.QuotaStateFile(cacheDir)
+	}
+	quota := api.NewQuotaTransport(api.NewInstrumentedTransport(http.DefaultTransport), stateFile)
+	upstream := api.NewRetryTransport(quota)
+	transport, err := cache.NewTransport(upstream, cache.Config{
+		TTL:     ttl,
+		MinTTL:  api.GetDurationWithDefault("WEX_TTL_MIN", ttl),
+		MaxTTL:  api.GetDurationWithDefault("WEX_TTL_MAX", max(DefaultMaxTTL, ttl)),
+		Dir:     cacheDir,
+		MaxSize: int64(api.GetIntWithDefault("WEX_CACHE_MAX_SIZE", DefaultCacheSizeMiB)) << 20,
+		Observe: api.ObserveCache,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   api.GetDurationWithDefault("WEX_HTTP_TIMEOUT", DefaultHTTPTimeout),
+	}, quota, nil
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+	"github.com/gca3020/weather_exporter/internal/exporter"
+	"github.com/gca3020/weather_exporter/internal/redact"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Other names which are accepted for each provider, in addition to the keys of its WEX_ variables
+var providerAliases = map[string]string{
+	"openmeteo":      "omet",
+	"owm":            "ow",
+	"openweathermap": "ow",
+	"tomorrowio":     "tio",
+	"weatherapi":     "wapi",
+}
+
+// query fetches the current conditions for a single location from a single provider, and prints
+// them in the requested format. This uses the same settings as the exporter (such as API keys), but
+// ignores the configured locations. It returns the exit code.
+func query(args []string) int {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	provider := flags.String("provider", "", "The provider to query: omet, ow, tio or wapi")
+	lat := flags.Float64("lat", 0, "The latitude of the location to query")
+	lon := flags.Float64("lon", 0, "The longitude of the location to query")
+	format := flags.String("format", "table", "The output format: table, json or prom")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Every location is valid, so without this a forgotten flag would quietly query 0,0
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range []string{"provider", "lat", "lon"} {
+		if !set[name] {
+			fmt.Fprintf(os.Stderr, "query: --%s is required\n", name)
+			return 2
+		}
+	}
+	if *lat < -90 || *lat > 90 || *lon < -180 || *lon > 180 {
+		fmt.Fprintln(os.Stderr, "query: latitude must be within ±90 and longitude within ±180")
+		return 2
+	}
+	var print func(io.Writer, *api.CurrentConditions) error
+	switch *format {
+	case "table":
+		print = printTable
+	case "json":
+		print = printJSON
+	case "prom":
+		print = printProm
+	default:
+		fmt.Fprintf(os.Stderr, "query: unknown format %q, expected table, json or prom\n", *format)
+		return 2
+	}
+
+	// Only warnings are logged by default, to stderr, so that they don't get mixed into the output
+	if configPath := api.GetStringWithDefault("WEX_CONFIG_FILE", ""); configPath != "" {
+		if err := api.LoadConfigFile(configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "query: unable to load configuration file: %v\n", err)
+			return 1
+		}
+	}
+	level, _ := logLevel("warn")
+	slog.SetDefault(slog.New(redact.NewHandler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))))
+
+	client, _, err := newClient(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "query: unable to create cache: %v\n", err)
+		return 1
+	}
+	key := *provider
+	if alias, ok := providerAliases[key]; ok {
+		key = alias
+	}
+	weather, err := api.New(client, key, api.Coordinate{Lat: *lat, Lon: *lon})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "query: %v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	conditions, err := weather.GetCurrentConditions(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "query: %v (%s)\n", redact.Error(err), api.ErrorKind(err))
+		return 1
+	}
+	if err := print(os.Stdout, conditions); err != nil {
+		fmt.Fprintf(os.Stderr, "query: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printTable(w io.Writer, c *api.CurrentConditions) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "provider\t%s\n", c.Provider)
+	fmt.Fprintf(tw, "location\t%s\n", c.LocationName)
+	fmt.Fprintf(tw, "coordinates\t%s\n", c.Coordinates)
+	fmt.Fprintf(tw, "description\t%s\n", c.Description)
+	fmt.Fprintf(tw, "condition\t%s\n", c.Condition)
+	for _, f := range api.Fields {
+		value := "-"
+		if v := *f.Value(c); !api.IsMissing(v) {
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", f.Name, value)
+	}
+	return tw.Flush()
+}
+
+// printJSON prints the conditions in the same format as the conditions API
+func printJSON(w io.Writer, c *api.CurrentConditions) error {
+	return exporter.WriteConditions(w, []exporter.TargetState{{
+		Target:     api.Target{Provider: c.Provider, Coordinates: c.Coordinates},
+		LastPoll:   time.Now(),
+		Conditions: c,
+	}})
+}
+
+// printProm prints the conditions as the metrics that the exporter would serve for them
+func printProm(w io.Writer, c *api.CurrentConditions) error {
+	reg := prometheus.NewRegistry()
+	schema, _ := metricsSchema()
+	if err := reg.Register(exporter.NewCollector([]api.WeatherApi{staticApi{c}}, api.GetUnits(), schema)); err != nil {
+		return err
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		return err
+	}
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// staticApi returns conditions which have already been fetched, so that they can be passed through
+// the collector without querying the provider again
+type staticApi struct {
+	conditions *api.CurrentConditions
+}
+
+func (a staticApi) Target() api.Target {
+	return api.Target{Provider: a.conditions.Provider, Coordinates: a.conditions.Coordinates}
+}
+
+func (a staticApi) GetCurrentConditions(ctx context.Context) (*api.CurrentConditions, error) {
+	return a.conditions, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+	"github.com/gca3020/weather_exporter/internal/exporter"
+)
+
+// watchConfig rebuilds the APIs whenever a SIGHUP is received or the config file changes, and swaps
+// them into the collector. The HTTP server and client (along with its cache) are left untouched,
+// so settings which apply to those still require a restart.
+func watchConfig(path string, interval time.Duration, client *http.Client, collector *exporter.Collector) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var ticker <-chan time.Time
+	modTime := time.Time{}
+	if path != "" && interval > 0 {
+		ticker = time.NewTicker(interval).C
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+	}
+
+	for {
+		select {
+		case <-hup:
+			slog.Info("Received SIGHUP, reloading configuration")
+		case <-ticker:
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+			slog.Info("Configuration file changed, reloading", "path", path)
+		}
+
+		if path != "" {
+			if err := api.LoadConfigFile(path); err != nil {
+				slog.Error("Unable to reload configuration file, keeping the current configuration", "path", path, "err", err)
+				continue
+			}
+		}
+		// Problems are only logged the first time they are found, so forget those found before, in case
+		// they were fixed and have since come back
+		api.ResetConfigProblems()
+		apis := api.BuildAll(client)
+		collector.SetApis(apis)
+		slog.Info("Configuration reloaded", "apis", len(apis))
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+	"gopkg.in/yaml.v2"
+)
+
+// kitLogger adapts slog to the go-kit logger interface expected by the exporter-toolkit, which
+// logs alternating keys and values, with the level and message as ordinary keys.
+type kitLogger struct {
+	logger *slog.Logger
+}
+
+func (l kitLogger) Log(keyvals ...any) error {
+	level := slog.LevelInfo
+	msg := ""
+	attrs := make([]any, 0, len(keyvals))
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch key := fmt.Sprint(keyvals[i]); key {
+		case "level":
+			if err := level.UnmarshalText([]byte(fmt.Sprint(keyvals[i+1]))); err != nil {
+				level = slog.LevelInfo
+			}
+		case "msg":
+			msg = fmt.Sprint(keyvals[i+1])
+		default:
+			attrs = append(attrs, key, keyvals[i+1])
+		}
+	}
+	l.logger.Log(context.Background(), level, msg, attrs...)
+	return nil
+}
+
+// requireBearerToken rejects any request which does not carry the token in its Authorization
+// header. If no token is configured, every request is passed through. The /-/ health checks are
+// always passed through, since liveness and readiness probes cannot usually send the header, and
+// reveal nothing about the weather.
+func requireBearerToken(token *api.Secret, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := token.Value()
+		if expected == "" || strings.HasPrefix(r.URL.Path, "/-/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(expected)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkWebAuth reports a web config file with basic_auth_users alongside a bearer token. A request
+// can only carry one Authorization header, so no request could satisfy both.
+func checkWebAuth(webConfig string, token *api.Secret) error {
+	if webConfig == "" || token.Value() == "" {
+		return nil
+	}
+	data, err := os.ReadFile(webConfig)
+	if err != nil {
+		return err
+	}
+	cfg := struct {
+		Users map[string]string `yaml:"basic_auth_users"`
+	}{}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	if len(cfg.Users) > 0 {
+		return errors.New("basic_auth_users cannot be used together with WEX_WEB_BEARER_TOKEN, since both use the Authorization header")
+	}
+	return nil
+}
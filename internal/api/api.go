@@ -1,35 +1,61 @@
 package api
 
+import (
+	"context"
+	"time"
+)
+
 type WeatherApi interface {
-	GetCurrentConditions() (*CurrentConditions, error)
+	Target() Target // Identifies the provider and location, without querying the provider
+	GetCurrentConditions(ctx context.Context) (*CurrentConditions, error)
+}
+
+// Target identifies the provider and location an API reports the conditions for
+type Target struct {
+	Provider    string // Name of the API Provider, as in CurrentConditions
+	Coordinates string // Coordinates of the location, as in CurrentConditions
 }
 
+// CurrentConditions is the normalized set of conditions reported by a provider. Any measurement
+// the provider does not report is set to Missing, rather than left as zero.
 type CurrentConditions struct {
-	Provider     string // Name of the API Provider (e.g. "OpenWeatherMap", "OpenMeteo", "NOAA")
-	LocationName string // Friendly name of the location to which this conditions apply (e.g. "Denver, US", "Bangkok, Thailand")
-	Coordinates  string // Coordinates for this sample, as "Lat,Lon" (e.g. 147.25,-25.18)
+	Provider     string          // Name of the API Provider (e.g. "OpenWeatherMap", "OpenMeteo", "NOAA")
+	LocationName string          // Friendly name of the location to which this conditions apply (e.g. "Denver, US", "Bangkok, Thailand")
+	Coordinates  string          // Coordinates for this sample, as "Lat,Lon" (e.g. 147.25,-25.18)
+	Upstream     string          // When served through a failover chain, the provider which actually supplied these conditions
+	ObservedAt   time.Time       // When the provider observed these conditions, or zero if it does not say
+	Rejected     map[string]bool // Fields whose readings were rejected as implausible, which are not reported at all
+
+	Description   string    // Human-readable description of the current conditions, as given by the provider
+	Condition     Condition // The kind of weather, normalized between providers
+	Temp          float64   // Temperature at ground level (Celsius)
+	FeelsLike     float64   // Apparent, or "feels-like" temperature at ground level (Celsius)
+	Humidity      float64   // Relative humidity percent, from 0-100 (percent)
+	PressureGnd   float64   // Barometric pressure at ground level (hPa)
+	PressureSea   float64   // Barometric pressure at sea level (hPa)
+	Visibility    float64   // Visibility (meters)
+	WindSpeed     float64   // Wind speed (meters/sec)
+	WindDirection float64   // Wind direction (degrees)
+	WindGust      float64   // Wind gust speed (meters/sec)
+	Clouds        float64   // Cloud cover percentage from 0-100 (percent)
+	Rain          float64   // Hourly rainfall rate (mm)
+	Snow          float64   // Hourly snowfall rate (mm)
+	UvIndex       float64   // The Ultraviolet Index (UVI)
+	AqIndex       float64   // The US Air Quality Index (AQI)
+	CO            float64   // Carbon Monoxide Concentration (μg/m^3)
+	NO            float64   // Nitrogen Monoxide Concentration (μg/m^3)
+	NO2           float64   // Nitrogen Dioxide Concentration (μg/m^3)
+	O3            float64   // Ozone Concentration (μg/m^3)
+	SO2           float64   // Sulfur Dioxide Concentration (μg/m^3)
+	NH3           float64   // Ammonia Concentration (μg/m^3)
+	Pm2p5         float64   // Fine Particulate Matter (<2.5μm) Concentration (μg/m^3)
+	Pm10          float64   // Coarse Particulate Matter (<10μm) Concentration (μg/m^3)
+}
 
-	Description   string  // Human-readable description of the current conditions
-	Temp          float64 // Temperature at ground level (Celsius)
-	FeelsLike     float64 // Apparent, or "feels-like" temperature at ground level (Celsius)
-	Humidity      float64 // Relative humidity percent, from 0-100 (percent)
-	PressureGnd   float64 // Barometric pressure at ground level (hPa)
-	PressureSea   float64 // Barometric pressure at sea level (hPa)
-	Visibility    float64 // Visibility (meters)
-	WindSpeed     float64 // Wind speed (meters/sec)
-	WindDirection float64 // Wind direction (degrees)
-	WindGust      float64 // Wind gust speed (meters/sec)
-	Clouds        float64 // Cloud cover percentage from 0-100 (percent)
-	Rain          float64 // Hourly rainfall rate (mm)
-	Snow          float64 // Hourly snowfall rate (mm)
-	UvIndex       float64 // The Ultraviolet Index (UVI)
-	AqIndex       float64 // The US Air Quality Index (AQI)
-	CO            float64 // Carbon Monoxide Concentration (μg/m^3)
-	NO            float64 // Nitrogen Monoxide Concentration (μg/m^3)
-	NO2           float64 // Nitrogen Dioxide Concentration (μg/m^3)
-	O3            float64 // Ozone Concentration (μg/m^3)
-	SO2           float64 // Sulfur Dioxide Concentration (μg/m^3)
-	NH3           float64 // Ammonia Concentration (μg/m^3)
-	Pm2p5         float64 // Fine Particulate Matter (<2.5μm) Concentration (μg/m^3)
-	Pm10          float64 // Coarse Particulate Matter (<10μm) Concentration (μg/m^3)
+// unixTime converts a Unix timestamp from a provider, leaving it as zero if the provider sent none
+func unixTime(secs int64) time.Time {
+	if secs == 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0).UTC()
 }
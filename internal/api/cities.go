@@ -0,0 +1,218 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const earthRadiusKm = 6371
+
+type city struct {
+	name     string
+	lat, lon float64
+}
+
+// citiesGeocoder names locations after the nearest city in a table, without any requests. The
+// table is either the built-in list of major cities, or a GeoNames cities file (such as
+// cities15000.txt from https://download.geonames.org/export/dump/).
+type citiesGeocoder struct {
+	path        string
+	cities      []city
+	maxDistance float64 // In kilometers
+}
+
+func newCitiesGeocoder(path string, maxDistance int) *citiesGeocoder {
+	g := &citiesGeocoder{path: path, cities: builtinCities, maxDistance: float64(maxDistance)}
+	if path != "" {
+		cities, err := loadCities(path)
+		if err != nil {
+			configProblem("WEX_GEOCODER_CITIES_FILE", "unable to read the cities file, so using the built-in cities: %v", err)
+		} else {
+			g.cities = cities
+		}
+	}
+	return g
+}
+
+func (g *citiesGeocoder) ID() string {
+	return "cities|" + g.path + "|" + strconv.FormatFloat(g.maxDistance, 'f', -1, 64)
+}
+
+func (g *citiesGeocoder) Name(ctx context.Context, coord Coordinate) (string, error) {
+	name, nearest := "", math.Inf(1)
+	for _, c := range g.cities {
+		if d := distanceKm(coord.Lat, coord.Lon, c.lat, c.lon); d < nearest {
+			name, nearest = c.name, d
+		}
+	}
+	if nearest > g.maxDistance {
+		return "", nil
+	}
+	return name, nil
+}
+
+// distanceKm is the great-circle distance between two points, using the haversine formula
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// loadCities reads a GeoNames file, which is tab-separated with the name in the second column and
+// the latitude and longitude in the fifth and sixth
+func loadCities(path string) ([]city, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cities := make([]city, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < 6 {
+			continue
+		}
+		lat, latErr := strconv.ParseFloat(cols[4], 64)
+		lon, lonErr := strconv.ParseFloat(cols[5], 64)
+		if latErr != nil || lonErr != nil {
+			continue
+		}
+		cities = append(cities, city{name: cols[1], lat: lat, lon: lon})
+	}
+	return cities, scanner.Err()
+}
+
+// builtinCities is a small table of major cities, enough to name locations in and around them
+// without downloading anything
+var builtinCities = []city{
+	// Europe
+	{"Amsterdam", 52.3676, 4.9041},
+	{"Athens", 37.9838, 23.7275},
+	{"Barcelona", 41.3874, 2.1686},
+	{"Berlin", 52.5200, 13.4050},
+	{"Bern", 46.9480, 7.4474},
+	{"Brussels", 50.8503, 4.3517},
+	{"Bucharest", 44.4268, 26.1025},
+	{"Budapest", 47.4979, 19.0402},
+	{"Cologne", 50.9375, 6.9603},
+	{"Copenhagen", 55.6761, 12.5683},
+	{"Dublin", 53.3498, -6.2603},
+	{"Edinburgh", 55.9533, -3.1883},
+	{"Frankfurt", 50.1109, 8.6821},
+	{"Geneva", 46.2044, 6.1432},
+	{"Hamburg", 53.5511, 9.9937},
+	{"Helsinki", 60.1699, 24.9384},
+	{"Istanbul", 41.0082, 28.9784},
+	{"Kyiv", 50.4501, 30.5234},
+	{"Lisbon", 38.7223, -9.1393},
+	{"London", 51.5074, -0.1278},
+	{"Lyon", 45.7640, 4.8357},
+	{"Madrid", 40.4168, -3.7038},
+	{"Manchester", 53.4808, -2.2426},
+	{"Milan", 45.4642, 9.1900},
+	{"Moscow", 55.7558, 37.6173},
+	{"Munich", 48.1351, 11.5820},
+	{"Oslo", 59.9139, 10.7522},
+	{"Paris", 48.8566, 2.3522},
+	{"Prague", 50.0755, 14.4378},
+	{"Reykjavik", 64.1466, -21.9426},
+	{"Rome", 41.9028, 12.4964},
+	{"Stockholm", 59.3293, 18.0686},
+	{"Stuttgart", 48.7758, 9.1829},
+	{"Vienna", 48.2082, 16.3738},
+	{"Warsaw", 52.2297, 21.0122},
+	{"Zurich", 47.3769, 8.5417},
+
+	// Asia
+	{"Bangkok", 13.7563, 100.5018},
+	{"Beijing", 39.9042, 116.4074},
+	{"Bengaluru", 12.9716, 77.5946},
+	{"Chennai", 13.0827, 80.2707},
+	{"Delhi", 28.7041, 77.1025},
+	{"Dhaka", 23.8103, 90.4125},
+	{"Dubai", 25.2048, 55.2708},
+	{"Fukuoka", 33.5904, 130.4017},
+	{"Hanoi", 21.0278, 105.8342},
+	{"Ho Chi Minh City", 10.8231, 106.6297},
+	{"Hong Kong", 22.3193, 114.1694},
+	{"Jakarta", -6.2088, 106.8456},
+	{"Karachi", 24.8607, 67.0011},
+	{"Kolkata", 22.5726, 88.3639},
+	{"Kuala Lumpur", 3.1390, 101.6869},
+	{"Manila", 14.5995, 120.9842},
+	{"Mumbai", 19.0760, 72.8777},
+	{"Nagoya", 35.1815, 136.9066},
+	{"Osaka", 34.6937, 135.5023},
+	{"Riyadh", 24.7136, 46.6753},
+	{"Sapporo", 43.0618, 141.3545},
+	{"Seoul", 37.5665, 126.9780},
+	{"Shanghai", 31.2304, 121.4737},
+	{"Singapore", 1.3521, 103.8198},
+	{"Taipei", 25.0330, 121.5654},
+	{"Tehran", 35.6892, 51.3890},
+	{"Tel Aviv", 32.0853, 34.7818},
+	{"Tokyo", 35.6762, 139.6503},
+
+	// Africa
+	{"Accra", 5.6037, -0.1870},
+	{"Addis Ababa", 8.9806, 38.7578},
+	{"Cairo", 30.0444, 31.2357},
+	{"Cape Town", -33.9249, 18.4241},
+	{"Casablanca", 33.5731, -7.5898},
+	{"Johannesburg", -26.2041, 28.0473},
+	{"Lagos", 6.5244, 3.3792},
+	{"Nairobi", -1.2921, 36.8219},
+
+	// North America
+	{"Atlanta", 33.7490, -84.3880},
+	{"Austin", 30.2672, -97.7431},
+	{"Boston", 42.3601, -71.0589},
+	{"Calgary", 51.0447, -114.0719},
+	{"Chicago", 41.8781, -87.6298},
+	{"Dallas", 32.7767, -96.7970},
+	{"Denver", 39.7392, -104.9903},
+	{"Detroit", 42.3314, -83.0458},
+	{"Honolulu", 21.3069, -157.8583},
+	{"Houston", 29.7604, -95.3698},
+	{"Las Vegas", 36.1699, -115.1398},
+	{"Los Angeles", 34.0522, -118.2437},
+	{"Mexico City", 19.4326, -99.1332},
+	{"Miami", 25.7617, -80.1918},
+	{"Minneapolis", 44.9778, -93.2650},
+	{"Montreal", 45.5017, -73.5673},
+	{"New York", 40.7128, -74.0060},
+	{"Philadelphia", 39.9526, -75.1652},
+	{"Phoenix", 33.4484, -112.0740},
+	{"Portland", 45.5152, -122.6784},
+	{"Salt Lake City", 40.7608, -111.8910},
+	{"San Diego", 32.7157, -117.1611},
+	{"San Francisco", 37.7749, -122.4194},
+	{"Seattle", 47.6062, -122.3321},
+	{"Toronto", 43.6532, -79.3832},
+	{"Vancouver", 49.2827, -123.1207},
+	{"Washington", 38.9072, -77.0369},
+
+	// South America
+	{"Bogotá", 4.7110, -74.0721},
+	{"Buenos Aires", -34.6037, -58.3816},
+	{"Lima", -12.0464, -77.0428},
+	{"Rio de Janeiro", -22.9068, -43.1729},
+	{"Santiago", -33.4489, -70.6693},
+	{"São Paulo", -23.5505, -46.6333},
+
+	// Oceania
+	{"Auckland", -36.8485, 174.7633},
+	{"Brisbane", -27.4698, 153.0251},
+	{"Melbourne", -37.8136, 144.9631},
+	{"Perth", -31.9505, 115.8605},
+	{"Sydney", -33.8688, 151.2093},
+	{"Wellington", -41.2865, 174.7762},
+}
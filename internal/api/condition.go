@@ -0,0 +1,51 @@
+package api
+
+// Condition is the normalized kind of weather, mapped from each provider's own condition codes, so
+// that the conditions can be compared between providers without parsing their descriptions.
+type Condition int
+
+// The numeric value of each condition is exported as a metric, so new conditions must only ever be
+// added to the end.
+const (
+	ConditionUnknown Condition = iota
+	ConditionClear
+	ConditionPartlyCloudy
+	ConditionCloudy
+	ConditionFog
+	ConditionDrizzle
+	ConditionRain
+	ConditionFreezingRain
+	ConditionSleet
+	ConditionSnow
+	ConditionThunderstorm
+)
+
+var conditionNames = []string{
+	ConditionUnknown:      "unknown",
+	ConditionClear:        "clear",
+	ConditionPartlyCloudy: "partly_cloudy",
+	ConditionCloudy:       "cloudy",
+	ConditionFog:          "fog",
+	ConditionDrizzle:      "drizzle",
+	ConditionRain:         "rain",
+	ConditionFreezingRain: "freezing_rain",
+	ConditionSleet:        "sleet",
+	ConditionSnow:         "snow",
+	ConditionThunderstorm: "thunderstorm",
+}
+
+// Conditions lists every condition, in order of their numeric values
+var Conditions = func() []Condition {
+	all := make([]Condition, len(conditionNames))
+	for i := range all {
+		all[i] = Condition(i)
+	}
+	return all
+}()
+
+func (c Condition) String() string {
+	if c < 0 || int(c) >= len(conditionNames) {
+		return conditionNames[ConditionUnknown]
+	}
+	return conditionNames[c]
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ConfigProblem describes a setting which could not be used as given
+type ConfigProblem struct {
+	Env     string
+	Message string
+}
+
+func (p *ConfigProblem) Error() string {
+	return p.Env + ": " + p.Message
+}
+
+var (
+	problemsMu sync.Mutex
+	problems   []error
+)
+
+// globalSettings are the settings which apply to the whole exporter, rather than to one provider
+var globalSettings = []string{
+	"WEX_BIND_ADDR", "WEX_CACHE_DIR", "WEX_CACHE_MAX_SIZE", "WEX_CONFIG_FILE", "WEX_CONFIG_WATCH",
+	"WEX_FAILOVER", "WEX_GEOCODER", "WEX_GEOCODER_CITIES_FILE", "WEX_GEOCODER_MAX_DISTANCE",
+	"WEX_GEOCODER_URL", "WEX_HTTP_TIMEOUT", "WEX_LANG", "WEX_LOG_LEVEL", "WEX_METRICS_SCHEMA",
+	"WEX_RETRIES", "WEX_RETRY_BACKOFF", "WEX_RETRY_MAX_WAIT", "WEX_SHUTDOWN_TIMEOUT", "WEX_TTL",
+	"WEX_TTL_MAX", "WEX_TTL_MIN", "WEX_UNITS", "WEX_VALIDATION", "WEX_VALIDATION_MAX_JUMP",
+	"WEX_WEB_BEARER_TOKEN", "WEX_WEB_BEARER_TOKEN_FILE", "WEX_WEB_CONFIG_FILE",
+}
+
+// providerSettings are the suffixes of the WEX_<KEY>_ settings which every provider accepts
+var providerSettings = []string{"COORDS", "APIKEY", "APIKEY_FILE", "TTL", "TIMEOUT", "DAILY_LIMIT", "BURST"}
+
+// configProblem logs and records a problem with a setting, so that it can later be reported by
+// the check-config command. A problem that has already been recorded is ignored, since settings
+// such as API keys are read once for every location.
+func configProblem(env string, format string, args ...any) {
+	p := &ConfigProblem{Env: env, Message: fmt.Sprintf(format, args...)}
+
+	problemsMu.Lock()
+	defer problemsMu.Unlock()
+	for _, existing := range problems {
+		if *existing.(*ConfigProblem) == *p {
+			return
+		}
+	}
+	slog.Error("Invalid configuration", "env", p.Env, "problem", p.Message)
+	problems = append(problems, p)
+}
+
+// ResetConfigProblems forgets any problems recorded so far, before checking the configuration again
+func ResetConfigProblems() {
+	problemsMu.Lock()
+	defer problemsMu.Unlock()
+	problems = nil
+}
+
+// ConfigProblems returns every problem recorded with the settings read so far
+func ConfigProblems() []error {
+	problemsMu.Lock()
+	defer problemsMu.Unlock()
+	return append([]error(nil), problems...)
+}
+
+// knownSettings returns the name of every setting the exporter recognizes. This does not depend on
+// which settings have been read, since most provider settings are only read for the providers with
+// locations configured.
+func knownSettings() map[string]struct{} {
+	known := make(map[string]struct{})
+	for _, name := range globalSettings {
+		known[name] = struct{}{}
+	}
+	for _, q := range quantities {
+		known[q.env] = struct{}{}
+	}
+	for _, key := range factoryKeys() {
+		for _, suffix := range providerSettings {
+			known["WEX_"+strings.ToUpper(key)+"_"+suffix] = struct{}{}
+		}
+	}
+	return known
+}
+
+// UnknownSettings returns any WEX_ settings, from the environment or config file, which the exporter
+// does not recognize. These are usually typos of real settings.
+func UnknownSettings() []string {
+	names := make(map[string]struct{})
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "WEX_") {
+			names[name] = struct{}{}
+		}
+	}
+	configMu.RLock()
+	for name := range configFile {
+		names[name] = struct{}{}
+	}
+	configMu.RUnlock()
+
+	known := knownSettings()
+	unknown := make([]string, 0)
+	for name := range names {
+		if _, ok := known[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
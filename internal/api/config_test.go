@@ -0,0 +1,42 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestUnknownSettings(t *testing.T) {
+	// Settings for providers with no locations are still recognized, since they are never read
+	t.Setenv("WEX_OMET_COORDS", "40.7,-74.0")
+	t.Setenv("WEX_OW_APIKEY", "abcdefgh")
+	t.Setenv("WEX_TIO_APIKEY_FILE", "/run/secrets/tio")
+	t.Setenv("WEX_WAPI_TTL", "30m")
+	t.Setenv("WEX_LANG", "de")
+	t.Setenv("WEX_GEOCODER_URL", "https://nominatim.example.com")
+	t.Setenv("WEX_UNITS_SPEED", "kmh")
+	t.Setenv("WEX_OW_COORD", "40.7,-74.0")
+	t.Setenv("WEX_NOAA_COORDS", "40.7,-74.0")
+
+	path := filepath.Join(t.TempDir(), "weather.env")
+	if err := os.WriteFile(path, []byte("WEX_TTL=5m\nWEX_TTL_MINIMUM=1m\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { configFile = nil })
+
+	unknown := UnknownSettings()
+	for _, name := range []string{"WEX_OW_COORD", "WEX_NOAA_COORDS", "WEX_TTL_MINIMUM"} {
+		if !slices.Contains(unknown, name) {
+			t.Errorf("expected %s to be unknown", name)
+		}
+	}
+	for _, name := range []string{"WEX_OMET_COORDS", "WEX_OW_APIKEY", "WEX_TIO_APIKEY_FILE", "WEX_WAPI_TTL", "WEX_LANG", "WEX_GEOCODER_URL", "WEX_UNITS_SPEED", "WEX_TTL"} {
+		if slices.Contains(unknown, name) {
+			t.Errorf("expected %s to be recognized", name)
+		}
+	}
+}
@@ -1,51 +1,131 @@
 package api
 
 import (
-	"log/slog"
+	"bufio"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+var (
+	configMu   sync.RWMutex
+	configFile map[string]string
+)
+
+// LoadConfigFile reads settings from a file of "WEX_NAME=value" lines, in the same format as a
+// Docker env file. Settings in the file take precedence over the environment, and replace those
+// from any file loaded previously.
+func LoadConfigFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected NAME=value", path, lineNum)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		settings[strings.TrimSpace(name)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	configFile = settings
+	return nil
+}
+
+// lookup finds a setting in the config file, falling back to the environment
+func lookup(env string) (string, bool) {
+	configMu.RLock()
+	str, ok := configFile[env]
+	configMu.RUnlock()
+	if ok {
+		return str, true
+	}
+	return os.LookupEnv(env)
+}
+
 type Coordinate struct {
 	Lat float64
 	Lon float64
+	TTL time.Duration // How long to cache the conditions for this location, or zero for the provider's default
 }
 
-// Parses multiple Lat/Lon pairs, in the format "ENV=12.0,45.0;37.5,109.4"
-func GetCoordinates(coordinateEnv string) []Coordinate {
-	coordinates := make([]Coordinate, 0)
+// String formats the coordinate as "Lat,Lon", as used in the coordinates label
+func (c Coordinate) String() string {
+	return fmt.Sprintf("%v,%v", c.Lat, c.Lon)
+}
 
+// Parses multiple Lat/Lon pairs, in the format "ENV=12.0,45.0;37.5,109.4", each of which may be
+// followed by a cache TTL for that location, as in "ENV=12.0,45.0@5m;37.5,109.4@30m"
+func GetCoordinates(coordinateEnv string) []Coordinate {
 	// Grab the full list of coordinates from the environment
 	coordStr := GetStringWithDefault(coordinateEnv, "")
 
 	if coordStr == "" {
 		return nil
 	}
+	return parseCoordinates(coordinateEnv, coordStr)
+}
+
+// Parses the coordinates from a setting, recording a problem for any pair that is malformed or
+// out of range, and leaving it out of the result.
+func parseCoordinates(env string, coordStr string) []Coordinate {
+	coordinates := make([]Coordinate, 0)
 
 	// First split on semicolons to get the coordinate pairs
 	coordPairs := strings.Split(strings.TrimSpace(coordStr), ";")
 	for _, pair := range coordPairs {
-		// Next split on commas to get the lat/long
-		tokens := strings.Split(strings.TrimSpace(pair), ",")
-		if len(tokens) != 2 && len(tokens) != 0 {
-			slog.Error("Coordinate pair does not contain exactly two tokens", "pair", pair)
+		// Split off the TTL, if there is one, then split on commas to get the lat/long
+		latLon, ttlStr, hasTTL := strings.Cut(strings.TrimSpace(pair), "@")
+		ttl := time.Duration(0)
+		if hasTTL {
+			var err error
+			if ttl, err = time.ParseDuration(strings.TrimSpace(ttlStr)); err != nil || ttl <= 0 {
+				configProblem(env, "coordinate pair %q does not have a valid TTL", pair)
+				continue
+			}
+		}
+		tokens := strings.Split(latLon, ",")
+		if len(tokens) != 2 {
+			configProblem(env, "coordinate pair %q does not contain exactly two tokens", pair)
 			continue
 		}
 		lat, latErr := strconv.ParseFloat(strings.TrimSpace(tokens[0]), 64)
 		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(tokens[1]), 64)
 		if latErr != nil || lonErr != nil {
-			slog.Error("Error parsing latitude/longitude", "latErr", latErr, "lonErr", lonErr)
+			configProblem(env, "coordinate pair %q is not a valid latitude/longitude", pair)
+			continue
+		}
+		if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			configProblem(env, "coordinate pair %q is out of range, latitude must be within ±90 and longitude within ±180", pair)
 			continue
 		}
-		coordinates = append(coordinates, Coordinate{Lat: lat, Lon: lon})
+		coordinates = append(coordinates, Coordinate{Lat: lat, Lon: lon, TTL: ttl})
 	}
 	return coordinates
 }
 
 func GetStringWithDefault(env string, defaultVal string) string {
-	str, ok := os.LookupEnv(env)
+	str, ok := lookup(env)
 	if !ok {
 		return defaultVal
 	}
@@ -53,36 +133,39 @@ func GetStringWithDefault(env string, defaultVal string) string {
 }
 
 func GetDurationWithDefault(env string, defaultVal time.Duration) time.Duration {
-	str, ok := os.LookupEnv(env)
+	str, ok := lookup(env)
 	if !ok {
 		return defaultVal
 	}
 	val, err := time.ParseDuration(str)
 	if err != nil {
+		configProblem(env, "%q is not a valid duration, using the default of %v", str, defaultVal)
 		return defaultVal
 	}
 	return val
 }
 
 func GetIntWithDefault(env string, defaultVal int) int {
-	str, ok := os.LookupEnv(env)
+	str, ok := lookup(env)
 	if !ok {
 		return defaultVal
 	}
 	val, err := strconv.Atoi(str)
 	if err != nil {
+		configProblem(env, "%q is not a valid integer, using the default of %v", str, defaultVal)
 		return defaultVal
 	}
 	return val
 }
 
 func GetBoolWithDefault(env string, defaultVal bool) bool {
-	str, ok := os.LookupEnv(env)
+	str, ok := lookup(env)
 	if !ok {
 		return defaultVal
 	}
 	val, err := strconv.ParseBool(str)
 	if err != nil {
+		configProblem(env, "%q is not a valid boolean, using the default of %v", str, defaultVal)
 		return defaultVal
 	}
 	return val
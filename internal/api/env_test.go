@@ -0,0 +1,39 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCoordinates(t *testing.T) {
+	tests := []struct {
+		name     string
+		str      string
+		want     []Coordinate
+		problems int
+	}{
+		{"single pair", "40.7,-74.0", []Coordinate{{Lat: 40.7, Lon: -74}}, 0},
+		{"several pairs with spaces", " 40.7, -74.0 ; -33.9,151.2 ", []Coordinate{{Lat: 40.7, Lon: -74}, {Lat: -33.9, Lon: 151.2}}, 0},
+		{"per-location TTL", "40.7,-74.0@5m;-33.9,151.2", []Coordinate{{Lat: 40.7, Lon: -74, TTL: 5 * time.Minute}, {Lat: -33.9, Lon: 151.2}}, 0},
+		{"invalid TTL", "40.7,-74.0@soon", []Coordinate{}, 1},
+		{"zero TTL", "40.7,-74.0@0s", []Coordinate{}, 1},
+		{"too many tokens", "40.7,-74.0,10", []Coordinate{}, 1},
+		{"not a number", "north,-74.0", []Coordinate{}, 1},
+		{"out of range", "91,0;0,-181", []Coordinate{}, 2},
+		{"bad pairs are skipped", "40.7;-33.9,151.2", []Coordinate{{Lat: -33.9, Lon: 151.2}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ResetConfigProblems()
+			t.Cleanup(ResetConfigProblems)
+
+			if got := parseCoordinates("WEX_TEST_COORDS", tt.str); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+			if problems := ConfigProblems(); len(problems) != tt.problems {
+				t.Errorf("expected %d problem(s), got %v", tt.problems, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ErrAuth     = errors.New("authentication failed")
+	ErrQuota    = errors.New("quota exceeded")
+	ErrNotFound = errors.New("not found")
+	ErrUpstream = errors.New("upstream error")
+)
+
+var apiErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "api_errors_total",
+	Help:      "The number of failed requests to each provider, by the kind of error",
+}, []string{"provider", "kind"})
+
+// ProviderError is returned for any request to a provider which does not succeed, and can be
+// matched against ErrAuth, ErrQuota, ErrNotFound or ErrUpstream with errors.Is.
+type ProviderError struct {
+	Provider   string
+	Kind       error  // One of ErrAuth, ErrQuota, ErrNotFound or ErrUpstream
+	StatusCode int    // HTTP status code of the response, or zero if there was no usable response
+	Message    string // Error message given by the provider, if any
+	Err        error  // Underlying error, if there was no usable response
+}
+
+func (e *ProviderError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v: %v", e.Provider, e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%s: %v (%d): %s", e.Provider, e.Kind, e.StatusCode, e.Message)
+}
+
+func (e *ProviderError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// ErrorKind returns a short name for the kind of error, suitable for use as a label
+func ErrorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrAuth):
+		return "auth"
+	case errors.Is(err, ErrQuota):
+		return "quota"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	default:
+		return "upstream"
+	}
+}
+
+// errorDecoder extracts the message from a provider's error response body, along with the kind of
+// error if it can be determined more precisely than from the status code alone (or nil otherwise).
+type errorDecoder func(body []byte) (message string, kind error)
+
+// kindFromStatus classifies an error response by its HTTP status code
+func kindFromStatus(code int) error {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusTooManyRequests:
+		return ErrQuota
+	case http.StatusNotFound:
+		return ErrNotFound
+	default:
+		return ErrUpstream
+	}
+}
@@ -1,17 +1,117 @@
 package api
 
-import "net/http"
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gca3020/weather_exporter/internal/cache"
+)
 
 var factories []ApiFactory
 
 type ApiFactory interface {
-	Build(*http.Client) []WeatherApi
+	Key() string                             // Short name of the provider, as used in its WEX_<KEY>_ variables (e.g. "ow")
+	Build(*http.Client) []WeatherApi         // Builds an API for every location configured for the provider
+	New(*http.Client, Coordinate) WeatherApi // Builds an API for a single location
 }
 
 func BuildAll(client *http.Client) []WeatherApi {
 	apis := make([]WeatherApi, 0)
 	for _, factory := range factories {
-		apis = append(apis, factory.Build(client)...)
+		timeout := providerTimeout(factory)
+		for _, api := range factory.Build(client) {
+			apis = append(apis, withDeadline(api, timeout))
+		}
+	}
+	apis = append(apis, buildFailover(client)...)
+	return buildGeocoding(client, buildValidation(apis))
+}
+
+// New builds the API of a single provider for a single location, outside of the configured locations
+func New(client *http.Client, key string, coord Coordinate) (WeatherApi, error) {
+	factory := findFactory(strings.ToLower(key))
+	if factory == nil {
+		return nil, fmt.Errorf("unknown provider %q, expected one of %s", key, strings.Join(factoryKeys(), ", "))
+	}
+	return withGeocoder(withDeadline(factory.New(client, coord), providerTimeout(factory)), GetGeocoder(client)), nil
+}
+
+func factoryKeys() []string {
+	keys := make([]string, 0, len(factories))
+	for _, factory := range factories {
+		keys = append(keys, factory.Key())
+	}
+	return keys
+}
+
+func findFactory(key string) ApiFactory {
+	for _, factory := range factories {
+		if factory.Key() == key {
+			return factory
+		}
 	}
-	return apis
+	return nil
+}
+
+// deadlineApi bounds how long a provider may take to return the current conditions, including
+// any retries, when the provider is configured with a WEX_<KEY>_TIMEOUT.
+type deadlineApi struct {
+	api     WeatherApi
+	timeout time.Duration
+}
+
+func providerTimeout(factory ApiFactory) time.Duration {
+	return GetDurationWithDefault("WEX_"+strings.ToUpper(factory.Key())+"_TIMEOUT", 0)
+}
+
+// cacheTTL returns how long to cache the responses for a location, which is set either for the
+// location itself, or for every location of the provider with WEX_<KEY>_TTL
+func cacheTTL(factory ApiFactory, coord Coordinate) time.Duration {
+	ttl := GetDurationWithDefault("WEX_"+strings.ToUpper(factory.Key())+"_TTL", 0)
+	if coord.TTL > 0 {
+		return coord.TTL
+	}
+	return ttl
+}
+
+// ttlApi overrides how long the responses for a location are cached, and so how often the provider
+// is actually queried for it
+type ttlApi struct {
+	api WeatherApi
+	ttl time.Duration
+}
+
+func withTTL(api WeatherApi, ttl time.Duration) WeatherApi {
+	if ttl <= 0 {
+		return api
+	}
+	return &ttlApi{api: api, ttl: ttl}
+}
+
+func (a *ttlApi) Target() Target {
+	return a.api.Target()
+}
+
+func (a *ttlApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	return a.api.GetCurrentConditions(cache.WithTTL(ctx, a.ttl))
+}
+
+func withDeadline(api WeatherApi, timeout time.Duration) WeatherApi {
+	if timeout <= 0 {
+		return api
+	}
+	return &deadlineApi{api: api, timeout: timeout}
+}
+
+func (a *deadlineApi) Target() Target {
+	return a.api.Target()
+}
+
+func (a *deadlineApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.api.GetCurrentConditions(ctx)
 }
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	failoverProvider = "auto"
+
+	// How long a provider which failed is tried after the rest of its chain, rather than first, so
+	// that a provider which is down does not hold up every scrape
+	failoverBackoff = 5 * time.Minute
+)
+
+type failoverChain struct {
+	coord Coordinate
+	keys  []string
+}
+
+// Parses failover chains, in the format "ENV=12.0,45.0=ow,omet;37.5,109.4=wapi,omet", where each
+// location is followed by the providers to try for it, in order of preference.
+func getFailoverChains(chainEnv string) []failoverChain {
+	chains := make([]failoverChain, 0)
+	seen := make(map[string]bool)
+
+	chainStr := strings.TrimSpace(GetStringWithDefault(chainEnv, ""))
+	if chainStr == "" {
+		return nil
+	}
+
+	for _, entry := range strings.Split(chainStr, ";") {
+		coordStr, keyStr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			configProblem(chainEnv, "failover chain %q does not contain a provider list", entry)
+			continue
+		}
+		coords := parseCoordinates(chainEnv, coordStr)
+		if len(coords) != 1 {
+			continue
+		}
+		// Both chains would be reported under provider="auto" with the same labels, which fails the scrape
+		if seen[coords[0].String()] {
+			configProblem(chainEnv, "more than one failover chain for %s", coords[0])
+			continue
+		}
+		seen[coords[0].String()] = true
+
+		chain := failoverChain{coord: coords[0]}
+		for _, key := range strings.Split(keyStr, ",") {
+			chain.keys = append(chain.keys, strings.TrimSpace(key))
+		}
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+func buildFailover(client *http.Client) (apis []WeatherApi) {
+	for _, chain := range getFailoverChains("WEX_FAILOVER") {
+		a := &failoverApi{coord: chain.coord, failedAt: make(map[int]time.Time)}
+		for _, key := range chain.keys {
+			factory := findFactory(key)
+			if factory == nil {
+				configProblem("WEX_FAILOVER", "unknown provider %q in failover chain, expected one of %s", key, strings.Join(factoryKeys(), ", "))
+				continue
+			}
+			a.chain = append(a.chain, withDeadline(factory.New(client, chain.coord), providerTimeout(factory)))
+		}
+		if len(a.chain) == 0 {
+			continue
+		}
+
+		slog.Info("Creating new failover API", "coord", chain.coord, "providers", chain.keys)
+		apis = append(apis, a)
+	}
+	return
+}
+
+// failoverApi serves the conditions from the first provider in its chain which responds
+// successfully, under a single provider name, so that the series remain stable when a provider
+// becomes unavailable.
+type failoverApi struct {
+	coord Coordinate
+	chain []WeatherApi
+
+	mu       sync.Mutex
+	location string
+	upstream string
+	failedAt map[int]time.Time // When each provider in the chain last failed
+}
+
+func (a *failoverApi) Target() Target {
+	return Target{Provider: failoverProvider, Coordinates: a.coord.String()}
+}
+
+// order returns the chain in the order to try it, which is the order of preference, except that
+// providers which failed recently are moved to the end
+func (a *failoverApi) order() []int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	healthy, failed := make([]int, 0, len(a.chain)), make([]int, 0)
+	for i := range a.chain {
+		if at, ok := a.failedAt[i]; ok && time.Since(at) < failoverBackoff {
+			failed = append(failed, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	return append(healthy, failed...)
+}
+
+func (a *failoverApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	errs := make([]error, 0, len(a.chain))
+	order := a.order()
+	for n, i := range order {
+		// Each provider gets an equal share of the time left, so that one which hangs does not leave
+		// nothing for the rest of the chain
+		memberCtx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			memberCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(len(order)-n))
+		}
+		cc, err := a.chain[i].GetCurrentConditions(memberCtx)
+		cancel()
+		if err != nil {
+			errs = append(errs, err)
+			a.mu.Lock()
+			a.failedAt[i] = time.Now()
+			a.mu.Unlock()
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		delete(a.failedAt, i)
+
+		if a.upstream != cc.Provider {
+			if a.upstream != "" {
+				slog.Warn("Failover chain switched provider", "coord", a.coord, "from", a.upstream, "to", cc.Provider)
+			}
+			a.upstream = cc.Provider
+		}
+
+		// Providers disagree on what to call a location, so hold on to the first name we are given
+		// to avoid the location label changing along with the provider.
+		if a.location == "" {
+			a.location = cc.LocationName
+		}
+
+		cc.Upstream = cc.Provider
+		cc.Provider = failoverProvider
+		cc.LocationName = a.location
+		return cc, nil
+	}
+	return nil, fmt.Errorf("all providers failed for %v,%v: %w", a.coord.Lat, a.coord.Lon, errors.Join(errs...))
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// memberApi is a provider in a failover chain, which either fails with err or succeeds
+type memberApi struct {
+	provider string
+	err      error
+	calls    int
+}
+
+func (a *memberApi) Target() Target {
+	return Target{Provider: a.provider, Coordinates: "0,0"}
+}
+
+func (a *memberApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	a.calls++
+	if a.err != nil {
+		return nil, a.err
+	}
+	return &CurrentConditions{Provider: a.provider, LocationName: a.provider + " location", Coordinates: "0,0"}, nil
+}
+
+func newFailover(members ...*memberApi) *failoverApi {
+	a := &failoverApi{failedAt: make(map[int]time.Time)}
+	for _, m := range members {
+		a.chain = append(a.chain, m)
+	}
+	return a
+}
+
+func TestFailoverFallsThrough(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"auth", &ProviderError{Provider: "First", Kind: ErrAuth, StatusCode: 401}},
+		{"quota", &ProviderError{Provider: "First", Kind: ErrQuota, StatusCode: 429}},
+		{"not found", &ProviderError{Provider: "First", Kind: ErrNotFound, StatusCode: 404}},
+		{"upstream", &ProviderError{Provider: "First", Kind: ErrUpstream, StatusCode: 503}},
+		{"rate limited", ErrRateLimited},
+		{"provider timeout", context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, second := &memberApi{provider: "First", err: tt.err}, &memberApi{provider: "Second"}
+			cc, err := newFailover(first, second).GetCurrentConditions(context.Background())
+			if err != nil {
+				t.Fatalf("expected the second provider to be used, got %v", err)
+			}
+			if cc.Provider != failoverProvider || cc.Upstream != "Second" {
+				t.Errorf("expected provider=%s upstream=Second, got provider=%s upstream=%s", failoverProvider, cc.Provider, cc.Upstream)
+			}
+		})
+	}
+}
+
+func TestFailoverStopsWhenScrapeEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	first, second := &memberApi{provider: "First", err: context.Canceled}, &memberApi{provider: "Second"}
+	if _, err := newFailover(first, second).GetCurrentConditions(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the scrape's cancellation, got %v", err)
+	}
+	if second.calls != 0 {
+		t.Error("expected the rest of the chain not to be tried once the scrape has ended")
+	}
+}
+
+func TestFailoverAllFail(t *testing.T) {
+	quota := &ProviderError{Provider: "First", Kind: ErrQuota, StatusCode: 429}
+	auth := &ProviderError{Provider: "Second", Kind: ErrAuth, StatusCode: 401}
+	_, err := newFailover(&memberApi{provider: "First", err: quota}, &memberApi{provider: "Second", err: auth}).GetCurrentConditions(context.Background())
+	if !errors.Is(err, ErrQuota) || !errors.Is(err, ErrAuth) {
+		t.Errorf("expected the errors of every provider, got %v", err)
+	}
+}
+
+func TestFailoverOrder(t *testing.T) {
+	first, second := &memberApi{provider: "First", err: ErrRateLimited}, &memberApi{provider: "Second"}
+	a := newFailover(first, second)
+
+	steps := []struct {
+		name    string
+		setup   func()
+		want    string
+		callsTo int // Number of calls expected to the first provider afterwards
+	}{
+		{"preferred provider fails", func() {}, "Second", 1},
+		{"recently failed provider is tried last", func() {}, "Second", 1},
+		{"retried after the backoff", func() { a.failedAt[0] = time.Now().Add(-failoverBackoff) }, "Second", 2},
+		{"preferred again once it recovers", func() {
+			first.err = nil
+			a.failedAt[0] = time.Now().Add(-failoverBackoff)
+		}, "First", 3},
+	}
+	for _, step := range steps {
+		step.setup()
+		cc, err := a.GetCurrentConditions(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if cc.Upstream != step.want || first.calls != step.callsTo {
+			t.Errorf("%s: expected upstream %s after %d call(s) to the first provider, got %s after %d", step.name, step.want, step.callsTo, cc.Upstream, first.calls)
+		}
+	}
+
+	// The location name is kept from the first successful response, whichever provider gives it
+	cc, _ := a.GetCurrentConditions(context.Background())
+	if cc.LocationName != "Second location" {
+		t.Errorf("expected the first location name to be kept, got %q", cc.LocationName)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import "math"
+
+// Field describes one of the numeric measurements carried in CurrentConditions, so that code
+// which needs to treat every measurement the same way does not have to enumerate them by hand.
+type Field struct {
+	Name     string                            // Short name of the measurement, matching its metric name (e.g. "temperature")
+	Circular bool                              // Whether the value is an angle in degrees, which wraps around at 360
+	Value    func(*CurrentConditions) *float64 // Accessor for the measurement within a set of conditions
+}
+
+var Fields = []Field{
+	{Name: "temperature", Value: func(c *CurrentConditions) *float64 { return &c.Temp }},
+	{Name: "feelslike", Value: func(c *CurrentConditions) *float64 { return &c.FeelsLike }},
+	{Name: "humidity", Value: func(c *CurrentConditions) *float64 { return &c.Humidity }},
+	{Name: "pressure_msl", Value: func(c *CurrentConditions) *float64 { return &c.PressureSea }},
+	{Name: "pressure_surface", Value: func(c *CurrentConditions) *float64 { return &c.PressureGnd }},
+	{Name: "visibility", Value: func(c *CurrentConditions) *float64 { return &c.Visibility }},
+	{Name: "wind_speed", Value: func(c *CurrentConditions) *float64 { return &c.WindSpeed }},
+	{Name: "wind_dir", Circular: true, Value: func(c *CurrentConditions) *float64 { return &c.WindDirection }},
+	{Name: "wind_gust", Value: func(c *CurrentConditions) *float64 { return &c.WindGust }},
+	{Name: "cloud_pct", Value: func(c *CurrentConditions) *float64 { return &c.Clouds }},
+	{Name: "rain", Value: func(c *CurrentConditions) *float64 { return &c.Rain }},
+	{Name: "snow", Value: func(c *CurrentConditions) *float64 { return &c.Snow }},
+	{Name: "uv_index", Value: func(c *CurrentConditions) *float64 { return &c.UvIndex }},
+	{Name: "aq_index", Value: func(c *CurrentConditions) *float64 { return &c.AqIndex }},
+	{Name: "co_conc", Value: func(c *CurrentConditions) *float64 { return &c.CO }},
+	{Name: "no_conc", Value: func(c *CurrentConditions) *float64 { return &c.NO }},
+	{Name: "no2_conc", Value: func(c *CurrentConditions) *float64 { return &c.NO2 }},
+	{Name: "o3_conc", Value: func(c *CurrentConditions) *float64 { return &c.O3 }},
+	{Name: "so2_conc", Value: func(c *CurrentConditions) *float64 { return &c.SO2 }},
+	{Name: "nh3_conc", Value: func(c *CurrentConditions) *float64 { return &c.NH3 }},
+	{Name: "pm2p5_conc", Value: func(c *CurrentConditions) *float64 { return &c.Pm2p5 }},
+	{Name: "pm10_conc", Value: func(c *CurrentConditions) *float64 { return &c.Pm10 }},
+}
+
+// Missing is the value used for any measurement a provider does not report
+var Missing = math.NaN()
+
+// IsMissing reports whether a measurement was not reported by the provider
+func IsMissing(v float64) bool {
+	return math.IsNaN(v)
+}
+
+// orMissing returns a measurement decoded from a field which a provider may leave out of its
+// response, which would otherwise be indistinguishable from zero
+func orMissing(v *float64) float64 {
+	if v == nil {
+		return Missing
+	}
+	return *v
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long to wait before trying again to name a location which could not be geocoded, so that a
+// geocoder which is down is not queried on every scrape
+const geocodeRetry = time.Hour
+
+// Geocoder looks up the name of the place at a set of coordinates, for providers which do not name
+// the locations themselves (such as Open-Meteo).
+type Geocoder interface {
+	ID() string                                                 // Identifies the geocoder and its settings, since names are cached by it
+	Name(ctx context.Context, coord Coordinate) (string, error) // The name of the place, or "" if there is none nearby
+}
+
+// GetGeocoder builds the geocoder selected by WEX_GEOCODER, or returns nil if there is none
+func GetGeocoder(client *http.Client) Geocoder {
+	kind := strings.ToLower(strings.TrimSpace(GetStringWithDefault("WEX_GEOCODER", "none")))
+	switch kind {
+	case "none":
+		return nil
+	case "nominatim":
+		return newNominatimGeocoder(client, GetStringWithDefault("WEX_GEOCODER_URL", nominatimUrl), GetLanguage())
+	case "cities":
+		return newCitiesGeocoder(GetStringWithDefault("WEX_GEOCODER_CITIES_FILE", ""), GetIntWithDefault("WEX_GEOCODER_MAX_DISTANCE", 50))
+	}
+	configProblem("WEX_GEOCODER", "unknown geocoder %q, expected none, nominatim or cities", kind)
+	return nil
+}
+
+func buildGeocoding(client *http.Client, apis []WeatherApi) []WeatherApi {
+	geocoder := GetGeocoder(client)
+	if geocoder == nil {
+		return apis
+	}
+	for i, api := range apis {
+		apis[i] = withGeocoder(api, geocoder)
+	}
+	return apis
+}
+
+func withGeocoder(api WeatherApi, geocoder Geocoder) WeatherApi {
+	if geocoder == nil {
+		return api
+	}
+	return &geocodingApi{api: api, geocoder: geocoder}
+}
+
+// geocodingApi fills in the location name of conditions which the provider left unnamed
+type geocodingApi struct {
+	api      WeatherApi
+	geocoder Geocoder
+}
+
+func (a *geocodingApi) Target() Target {
+	return a.api.Target()
+}
+
+func (a *geocodingApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	cc, err := a.api.GetCurrentConditions(ctx)
+	if err != nil || cc.LocationName != "" {
+		return cc, err
+	}
+
+	named := *cc
+	named.LocationName = geocode(ctx, a.geocoder, cc.Coordinates)
+	return &named, nil
+}
+
+type geocodeEntry struct {
+	name    string
+	expires time.Time // Zero for names which were found, since places do not move
+}
+
+// The names are kept for the life of the process, rather than by each geocoder, so that they
+// survive the providers being rebuilt when the configuration is reloaded.
+var geocoded = struct {
+	mu      sync.Mutex
+	entries map[string]geocodeEntry
+}{entries: make(map[string]geocodeEntry)}
+
+// geocode returns the name of the place at a set of coordinates, as formatted by Coordinate.String,
+// or "" if it cannot be found.
+func geocode(ctx context.Context, geocoder Geocoder, coordinates string) string {
+	key := geocoder.ID() + "|" + coordinates
+	geocoded.mu.Lock()
+	entry, ok := geocoded.entries[key]
+	geocoded.mu.Unlock()
+	if ok && (entry.expires.IsZero() || time.Now().Before(entry.expires)) {
+		return entry.name
+	}
+
+	latStr, lonStr, _ := strings.Cut(coordinates, ",")
+	lat, latErr := strconv.ParseFloat(latStr, 64)
+	lon, lonErr := strconv.ParseFloat(lonStr, 64)
+	if latErr != nil || lonErr != nil {
+		return ""
+	}
+
+	name, err := geocoder.Name(ctx, Coordinate{Lat: lat, Lon: lon})
+	if ctx.Err() != nil {
+		// The scrape ran out of time, which says nothing about the geocoder, so try again next time
+		return ""
+	}
+	entry = geocodeEntry{name: name}
+	if err != nil {
+		slog.Warn("Unable to find the name of a location", "coordinates", coordinates, "err", err)
+		entry.expires = time.Now().Add(geocodeRetry)
+	} else {
+		slog.Info("Found the name of a location", "coordinates", coordinates, "name", name)
+	}
+
+	geocoded.mu.Lock()
+	geocoded.entries[key] = entry
+	geocoded.mu.Unlock()
+	return name
+}
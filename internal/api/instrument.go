@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "The time taken for each provider to respond to a request, by endpoint and status code",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider", "endpoint", "code"})
+	cacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_hits_total",
+		Help:      "The number of requests to each provider served from the cache",
+	}, []string{"provider"})
+	cacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_misses_total",
+		Help:      "The number of requests to each provider which could not be served from the cache",
+	}, []string{"provider"})
+)
+
+// InstrumentedTransport is an http.RoundTripper which times every request sent to a provider, up to
+// the point that the response headers are received. Each retry is timed separately.
+type InstrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func NewInstrumentedTransport(next http.RoundTripper) *InstrumentedTransport {
+	return &InstrumentedTransport{next: next}
+}
+
+func (t *InstrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	rsp, err := t.next.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(rsp.StatusCode)
+	}
+	upstreamDuration.WithLabelValues(ProviderFromContext(req.Context()), req.URL.Path, code).Observe(time.Since(start).Seconds())
+	return rsp, err
+}
+
+// ObserveCache counts a request as a cache hit or miss for its provider. Revalidating a stale copy
+// with the provider counts as a miss, since the provider is still asked for it.
+func ObserveCache(req *http.Request, hit bool) {
+	if hit {
+		cacheHits.WithLabelValues(ProviderFromContext(req.Context())).Inc()
+	} else {
+		cacheMisses.WithLabelValues(ProviderFromContext(req.Context())).Inc()
+	}
+}
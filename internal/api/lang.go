@@ -0,0 +1,50 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultLanguage is the language of the descriptions when WEX_LANG is not set
+const DefaultLanguage = "en"
+
+// Language codes are passed straight through to the providers which translate their own
+// descriptions, so only their shape is checked (e.g. "de", "pt_br" or "zh-TW").
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}([-_][a-z0-9]+)?$`)
+
+// GetLanguage reads the language for the condition descriptions from WEX_LANG
+func GetLanguage() string {
+	lang := strings.ToLower(strings.TrimSpace(GetStringWithDefault("WEX_LANG", DefaultLanguage)))
+	if !languagePattern.MatchString(lang) {
+		configProblem("WEX_LANG", "invalid language %q, expected a code such as en, de or ja", lang)
+		return DefaultLanguage
+	}
+	return lang
+}
+
+// languageTag converts a language code as the providers write it (e.g. "pt_br") to a BCP 47 tag
+// (e.g. "pt-BR"), as expected by services which follow the Accept-Language conventions
+func languageTag(lang string) string {
+	base, sub, ok := strings.Cut(strings.ReplaceAll(lang, "_", "-"), "-")
+	if !ok {
+		return base
+	}
+	switch len(sub) {
+	case 2: // Region, such as "BR"
+		sub = strings.ToUpper(sub)
+	case 4: // Script, such as "Hant"
+		sub = strings.ToUpper(sub[:1]) + sub[1:]
+	}
+	return base + "-" + sub
+}
+
+// describe looks up the description of a condition code in the table for a language, ignoring any
+// region (so "de-AT" uses the "de" table), and falling back to English where there is no translation.
+func describe(tables map[string]map[int]string, lang string, code int) (string, bool) {
+	base, _, _ := strings.Cut(strings.ReplaceAll(lang, "_", "-"), "-")
+	if desc, ok := tables[base][code]; ok {
+		return desc, true
+	}
+	desc, ok := tables[DefaultLanguage][code]
+	return desc, ok
+}
@@ -0,0 +1,18 @@
+package api
+
+import "testing"
+
+func TestLanguageTag(t *testing.T) {
+	tests := map[string]string{
+		"en":      "en",
+		"pt_br":   "pt-BR",
+		"zh-tw":   "zh-TW",
+		"zh_hant": "zh-Hant",
+		"es-419":  "es-419",
+	}
+	for lang, want := range tests {
+		if got := languageTag(lang); got != want {
+			t.Errorf("%s: expected %q, got %q", lang, want, got)
+		}
+	}
+}
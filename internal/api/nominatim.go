@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	nominatimProvider = "Nominatim"
+	nominatimUrl      = "https://nominatim.openstreetmap.org/reverse"
+
+	// The public Nominatim instance allows at most one request per second
+	nominatimInterval = time.Second
+)
+
+// nominatimGeocoder looks up names with the reverse geocoding API of Nominatim, either the public
+// instance run by OpenStreetMap or a self-hosted one.
+type nominatimGeocoder struct {
+	client *http.Client
+	url    string
+	lang   string
+
+	// Held while a request is made, so that requests are spaced out even when many locations are
+	// named at once
+	sem  chan struct{}
+	last time.Time
+}
+
+func newNominatimGeocoder(client *http.Client, url string, lang string) *nominatimGeocoder {
+	return &nominatimGeocoder{client: client, url: url, lang: lang, sem: make(chan struct{}, 1)}
+}
+
+func (g *nominatimGeocoder) ID() string {
+	return "nominatim|" + g.url + "|" + g.lang
+}
+
+type nominatimPlace struct {
+	Name    string `json:"name"`
+	Address struct {
+		City         string `json:"city"`
+		Town         string `json:"town"`
+		Village      string `json:"village"`
+		Municipality string `json:"municipality"`
+		County       string `json:"county"`
+	} `json:"address"`
+	Error string `json:"error"`
+}
+
+// Nominatim errors look like {"error":"Unable to geocode"}, which is also how it reports
+// coordinates with nothing nearby, though with a 200 status
+func nominatimError(body []byte) (string, error) {
+	e := struct {
+		Error string `json:"error"`
+	}{}
+	json.Unmarshal(body, &e)
+	return e.Error, nil
+}
+
+func (g *nominatimGeocoder) Name(ctx context.Context, coord Coordinate) (string, error) {
+	select {
+	case g.sem <- struct{}{}:
+		defer func() { <-g.sem }()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if wait := time.Until(g.last.Add(nominatimInterval)); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	defer func() { g.last = time.Now() }()
+
+	// Zoom level 10 asks for the nearest city, rather than the street or building
+	url := fmt.Sprintf("%s?format=jsonv2&lat=%v&lon=%v&zoom=10&accept-language=%s", g.url, coord.Lat, coord.Lon, languageTag(g.lang))
+	header := http.Header{}
+	header.Set("User-Agent", "weather_exporter (https://github.com/gca3020/weather_exporter)")
+
+	place := &nominatimPlace{}
+	if err := getJSON(ctx, g.client, nominatimProvider, url, header, place, nominatimError); err != nil {
+		return "", err
+	}
+	if place.Error != "" {
+		return "", nil
+	}
+
+	for _, name := range []string{place.Address.City, place.Address.Town, place.Address.Village, place.Address.Municipality, place.Name, place.Address.County} {
+		if name != "" {
+			return name, nil
+		}
+	}
+	return "", nil
+}
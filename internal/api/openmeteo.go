@@ -1,9 +1,9 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -16,16 +16,24 @@ const (
 type ometFactory struct {
 }
 
+func (f *ometFactory) Key() string {
+	return "omet"
+}
+
 func (f *ometFactory) Build(client *http.Client) (apis []WeatherApi) {
 	coordinates := GetCoordinates("WEX_OMET_COORDS")
 
 	for _, coord := range coordinates {
-		slog.Info("Creating new Open-Meteo API", "coord", coord)
-		apis = append(apis, newOmetApi(client, coord))
+		apis = append(apis, f.New(client, coord))
 	}
 	return
 }
 
+func (f *ometFactory) New(client *http.Client, coord Coordinate) WeatherApi {
+	slog.Info("Creating new Open-Meteo API", "coord", coord)
+	return withTTL(newOmetApi(client, coord, GetLanguage()), cacheTTL(f, coord))
+}
+
 func init() {
 	factories = append(factories, &ometFactory{})
 }
@@ -33,30 +41,38 @@ func init() {
 type ometApi struct {
 	client *http.Client
 	coord  Coordinate
+	lang   string
 }
 
-func newOmetApi(client *http.Client, coordinate Coordinate) *ometApi {
+func newOmetApi(client *http.Client, coordinate Coordinate, lang string) *ometApi {
 	return &ometApi{
 		client: client,
 		coord:  coordinate,
+		lang:   lang,
 	}
 }
 
-func (a *ometApi) GetCurrentConditions() (*CurrentConditions, error) {
-	f, err := a.getForecast()
+func (a *ometApi) Target() Target {
+	return Target{Provider: ometProvider, Coordinates: a.coord.String()}
+}
+
+func (a *ometApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	f, err := a.getForecast(ctx)
 	if err != nil {
 		return nil, err
 	}
-	aq, err := a.getAirQuality()
+	aq, err := a.getAirQuality(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	return &CurrentConditions{
 		Provider:      ometProvider,
-		LocationName:  "", // TODO: Reverse Geocoding?
-		Coordinates:   fmt.Sprintf("%v,%v", a.coord.Lat, a.coord.Lon),
-		Description:   codeToString(f.Current.Code),
+		LocationName:  "", // Named by the geocoder, if one is configured
+		Coordinates:   a.coord.String(),
+		ObservedAt:    unixTime(f.Current.Time),
+		Description:   codeToString(a.lang, f.Current.Code),
+		Condition:     wmoCondition(f.Current.Code),
 		Temp:          f.Current.Temperature,
 		FeelsLike:     f.Current.FeelsLike,
 		Humidity:      f.Current.Humidity,
@@ -78,13 +94,14 @@ func (a *ometApi) GetCurrentConditions() (*CurrentConditions, error) {
 		NH3:           aq.Current.NH3,
 		Pm2p5:         aq.Current.Pm2p5,
 		Pm10:          aq.Current.Pm10,
-		//NO:          // Not available in Open-Meteo
+		NO:            Missing, // Not available in Open-Meteo
 	}, nil
 }
 
 type ometForecast struct {
 	Elevation float64 `json:"elevation"`
 	Current   struct {
+		Time            int64   `json:"time"`
 		Temperature     float64 `json:"temperature_2m"`
 		Humidity        float64 `json:"relative_humidity_2m"`
 		FeelsLike       float64 `json:"apparent_temperature"`
@@ -116,8 +133,17 @@ type ometAirQuality struct {
 	} `json:"current"`
 }
 
-func (a *ometApi) getForecast() (*ometForecast, error) {
-	url := fmt.Sprintf("%s?latitude=%v&longitude=%v&current=%s",
+// Open-Meteo errors look like {"error":true,"reason":"Latitude must be in range of -90 to 90°."}
+func ometError(body []byte) (string, error) {
+	e := struct {
+		Reason string `json:"reason"`
+	}{}
+	json.Unmarshal(body, &e)
+	return e.Reason, nil
+}
+
+func (a *ometApi) getForecast(ctx context.Context) (*ometForecast, error) {
+	url := fmt.Sprintf("%s?latitude=%v&longitude=%v&timeformat=unixtime&current=%s",
 		"https://api.open-meteo.com/v1/forecast",
 		a.coord.Lat, a.coord.Lon,
 		strings.Join([]string{
@@ -139,16 +165,8 @@ func (a *ometApi) getForecast() (*ometForecast, error) {
 		}, ","),
 	)
 
-	rsp, err := a.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	rspData, err := io.ReadAll(rsp.Body)
-	if err != nil {
-		return nil, err
-	}
 	ret := &ometForecast{}
-	err = json.Unmarshal(rspData, ret)
+	err := getJSON(ctx, a.client, ometProvider, url, nil, ret, ometError)
 	if err != nil {
 		return nil, err
 	}
@@ -156,7 +174,7 @@ func (a *ometApi) getForecast() (*ometForecast, error) {
 	return ret, nil
 }
 
-func (a *ometApi) getAirQuality() (*ometAirQuality, error) {
+func (a *ometApi) getAirQuality(ctx context.Context) (*ometAirQuality, error) {
 	url := fmt.Sprintf("%s?latitude=%v&longitude=%v&current=%s",
 		"https://air-quality-api.open-meteo.com/v1/air-quality",
 		a.coord.Lat, a.coord.Lon,
@@ -173,17 +191,8 @@ func (a *ometApi) getAirQuality() (*ometAirQuality, error) {
 		}, ","),
 	)
 
-	rsp, err := a.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	rspData, err := io.ReadAll(rsp.Body)
-	if err != nil {
-		return nil, err
-	}
-
 	ret := &ometAirQuality{}
-	err = json.Unmarshal(rspData, ret)
+	err := getJSON(ctx, a.client, ometProvider, url, nil, ret, ometError)
 	if err != nil {
 		return nil, err
 	}
@@ -222,9 +231,99 @@ var codeMap = map[int]string{
 	99: "Thunderstorm with heavy hail",
 }
 
-func codeToString(code int) string {
-	if desc, ok := codeMap[code]; ok {
+// Open-Meteo only reports the WMO code, so the descriptions are translated here rather than by the provider
+var codeMaps = map[string]map[int]string{
+	"en": codeMap,
+	"de": {
+		0:  "Klarer Himmel",
+		1:  "Überwiegend klar",
+		2:  "Teilweise bewölkt",
+		3:  "Bedeckt",
+		45: "Nebel",
+		48: "Nebel mit Reifbildung",
+		51: "Leichter Nieselregen",
+		53: "Mäßiger Nieselregen",
+		55: "Starker Nieselregen",
+		56: "Leichter gefrierender Nieselregen",
+		57: "Starker gefrierender Nieselregen",
+		61: "Leichter Regen",
+		63: "Mäßiger Regen",
+		65: "Starker Regen",
+		66: "Leichter gefrierender Regen",
+		67: "Starker gefrierender Regen",
+		71: "Leichter Schneefall",
+		73: "Mäßiger Schneefall",
+		75: "Starker Schneefall",
+		77: "Schneegriesel",
+		80: "Leichte Regenschauer",
+		81: "Mäßige Regenschauer",
+		82: "Heftige Regenschauer",
+		85: "Leichte Schneeschauer",
+		86: "Starke Schneeschauer",
+		95: "Gewitter",
+		96: "Gewitter mit leichtem Hagel",
+		99: "Gewitter mit starkem Hagel",
+	},
+	"ja": {
+		0:  "快晴",
+		1:  "晴れ",
+		2:  "一部曇り",
+		3:  "曇り",
+		45: "霧",
+		48: "着氷性の霧",
+		51: "弱い霧雨",
+		53: "霧雨",
+		55: "強い霧雨",
+		56: "弱い着氷性の霧雨",
+		57: "強い着氷性の霧雨",
+		61: "弱い雨",
+		63: "雨",
+		65: "強い雨",
+		66: "弱い着氷性の雨",
+		67: "強い着氷性の雨",
+		71: "弱い雪",
+		73: "雪",
+		75: "強い雪",
+		77: "霧雪",
+		80: "弱いにわか雨",
+		81: "にわか雨",
+		82: "激しいにわか雨",
+		85: "弱いにわか雪",
+		86: "強いにわか雪",
+		95: "雷雨",
+		96: "雷雨（弱いひょう）",
+		99: "雷雨（強いひょう）",
+	},
+}
+
+func codeToString(lang string, code int) string {
+	if desc, ok := describe(codeMaps, lang, code); ok {
 		return desc
 	}
 	return fmt.Sprintf("Unknown (%d)", code)
 }
+
+// wmoCondition maps the WMO weather interpretation codes used by Open-Meteo to a Condition
+func wmoCondition(code int) Condition {
+	switch code {
+	case 0, 1:
+		return ConditionClear
+	case 2:
+		return ConditionPartlyCloudy
+	case 3:
+		return ConditionCloudy
+	case 45, 48:
+		return ConditionFog
+	case 51, 53, 55:
+		return ConditionDrizzle
+	case 56, 57, 66, 67:
+		return ConditionFreezingRain
+	case 61, 63, 65, 80, 81, 82:
+		return ConditionRain
+	case 71, 73, 75, 77, 85, 86:
+		return ConditionSnow
+	case 95, 96, 99:
+		return ConditionThunderstorm
+	}
+	return ConditionUnknown
+}
@@ -1,9 +1,9 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 )
@@ -16,61 +16,79 @@ const (
 type owmFactory struct {
 }
 
+func (f *owmFactory) Key() string {
+	return "ow"
+}
+
 func (f *owmFactory) Build(client *http.Client) (apis []WeatherApi) {
 	coordinates := GetCoordinates("WEX_OW_COORDS")
-	apiKey := GetStringWithDefault("WEX_OW_APIKEY", "")
 
 	for _, coord := range coordinates {
-		slog.Info("Creating new OpenWeather API", "coord", coord)
-		apis = append(apis, newOwmApi(client, apiKey, coord))
+		apis = append(apis, f.New(client, coord))
 	}
 	return
 }
 
+func (f *owmFactory) New(client *http.Client, coord Coordinate) WeatherApi {
+	apiKey := GetSecret("WEX_OW_APIKEY")
+	if apiKey.Value() == "" {
+		configProblem("WEX_OW_APIKEY", "no API key is set for the configured locations")
+	}
+
+	slog.Info("Creating new OpenWeather API", "coord", coord)
+	return withTTL(newOwmApi(client, apiKey, coord, GetLanguage()), cacheTTL(f, coord))
+}
+
 func init() {
 	factories = append(factories, &owmFactory{})
 }
 
 type owmApi struct {
 	client *http.Client
-	key    string
+	key    *Secret
 	coord  Coordinate
 	units  string
+	lang   string
 }
 
-func newOwmApi(client *http.Client, key string, coordinate Coordinate) *owmApi {
+func newOwmApi(client *http.Client, key *Secret, coordinate Coordinate, lang string) *owmApi {
 	return &owmApi{
 		client: client,
 		key:    key,
 		coord:  coordinate,
 		units:  "metric",
+		lang:   lang,
 	}
 }
 
-func (a *owmApi) GetCurrentConditions() (*CurrentConditions, error) {
-	c, err := a.getCurrentConditions()
+func (a *owmApi) Target() Target {
+	return Target{Provider: owmProvider, Coordinates: a.coord.String()}
+}
+
+func (a *owmApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	c, err := a.getCurrentConditions(ctx)
 	if err != nil {
 		return nil, err
 	}
-	uv, err := a.getUvIndex()
+	uv, err := a.getUvIndex(ctx)
 	if err != nil {
 		return nil, err
 	}
-	ap, err := a.getAirPollution()
+	ap, err := a.getAirPollution(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &CurrentConditions{
+	cc := &CurrentConditions{
 		Provider:      owmProvider,
 		LocationName:  c.Name,
-		Coordinates:   fmt.Sprintf("%v,%v", a.coord.Lat, a.coord.Lon),
-		Description:   c.Weather[0].Description,
+		Coordinates:   a.coord.String(),
+		ObservedAt:    unixTime(c.Dt),
 		Temp:          c.Main.Temp,
 		FeelsLike:     c.Main.FeelsLike,
 		Humidity:      c.Main.Humidity,
-		PressureGnd:   c.Main.GrndLevel, // OWM appears to omit this in the US
-		PressureSea:   c.Main.Pressure,  // OWM's primary pressure stat is always present, and is sea-level pressure.
+		PressureGnd:   orMissing(c.Main.GrndLevel), // OWM appears to omit this in the US
+		PressureSea:   c.Main.Pressure,             // OWM's primary pressure stat is always present, and is sea-level pressure.
 		Visibility:    c.Visibility,
 		WindSpeed:     c.Wind.Speed,
 		WindDirection: c.Wind.Deg,
@@ -79,32 +97,45 @@ func (a *owmApi) GetCurrentConditions() (*CurrentConditions, error) {
 		Rain:          c.Rain.OneHour,
 		Snow:          c.Snow.OneHour,
 		UvIndex:       uv.Value,
-		AqIndex:       ap.List[0].Main.Aqi,
-		CO:            ap.List[0].Components.Co,
-		NO:            ap.List[0].Components.No,
-		NO2:           ap.List[0].Components.No2,
-		O3:            ap.List[0].Components.O3,
-		SO2:           ap.List[0].Components.So2,
-		NH3:           ap.List[0].Components.Nh3,
-		Pm2p5:         ap.List[0].Components.Pm2p5,
-		Pm10:          ap.List[0].Components.Pm10,
-	}, nil
+	}
+
+	// Either list may come back empty, in which case there is nothing to report
+	if len(c.Weather) > 0 {
+		cc.Description = c.Weather[0].Description
+		cc.Condition = owmCondition(c.Weather[0].ID)
+	}
+	if len(ap.List) > 0 {
+		cc.AqIndex = ap.List[0].Main.Aqi
+		cc.CO = ap.List[0].Components.Co
+		cc.NO = ap.List[0].Components.No
+		cc.NO2 = ap.List[0].Components.No2
+		cc.O3 = ap.List[0].Components.O3
+		cc.SO2 = ap.List[0].Components.So2
+		cc.NH3 = ap.List[0].Components.Nh3
+		cc.Pm2p5 = ap.List[0].Components.Pm2p5
+		cc.Pm10 = ap.List[0].Components.Pm10
+	} else {
+		cc.AqIndex, cc.CO, cc.NO, cc.NO2, cc.O3 = Missing, Missing, Missing, Missing, Missing
+		cc.SO2, cc.NH3, cc.Pm2p5, cc.Pm10 = Missing, Missing, Missing, Missing
+	}
+	return cc, nil
 }
 
 type owCurrentConditions struct {
 	Weather []struct {
+		ID          int    `json:"id"`
 		Main        string `json:"main"`
 		Description string `json:"description"`
 	} `json:"weather"`
 	Main struct {
-		Temp      float64 `json:"temp"`
-		FeelsLike float64 `json:"feels_like"`
-		TempMin   float64 `json:"temp_min"`
-		TempMax   float64 `json:"temp_max"`
-		Pressure  float64 `json:"pressure"`
-		Humidity  float64 `json:"humidity"`
-		SeaLevel  float64 `json:"sea_level"`
-		GrndLevel float64 `json:"grnd_level"`
+		Temp      float64  `json:"temp"`
+		FeelsLike float64  `json:"feels_like"`
+		TempMin   float64  `json:"temp_min"`
+		TempMax   float64  `json:"temp_max"`
+		Pressure  float64  `json:"pressure"`
+		Humidity  float64  `json:"humidity"`
+		SeaLevel  float64  `json:"sea_level"`
+		GrndLevel *float64 `json:"grnd_level"`
 	} `json:"main"`
 	Visibility float64 `json:"visibility"`
 	Wind       struct {
@@ -127,6 +158,7 @@ type owCurrentConditions struct {
 		Sunrise int64 `json:"sunrise"`
 		Sunset  int64 `json:"sunset"`
 	}
+	Dt   int64  `json:"dt"`
 	Name string `json:"name"`
 }
 
@@ -152,18 +184,21 @@ type owUvIndex struct {
 	Value float64 `json:"value"`
 }
 
-func (a *owmApi) getCurrentConditions() (*owCurrentConditions, error) {
-	url := fmt.Sprintf("%s/weather?lat=%f&lon=%f&appid=%s&units=%s", owmApiBase, a.coord.Lat, a.coord.Lon, a.key, a.units)
-	rsp, err := a.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	rspData, err := io.ReadAll(rsp.Body)
-	if err != nil {
-		return nil, err
-	}
+// OpenWeatherMap errors look like {"cod":401,"message":"Invalid API key"}, though "cod" is
+// sometimes a string, so only the message is used.
+func owmError(body []byte) (string, error) {
+	e := struct {
+		Message string `json:"message"`
+	}{}
+	json.Unmarshal(body, &e)
+	return e.Message, nil
+}
+
+func (a *owmApi) getCurrentConditions(ctx context.Context) (*owCurrentConditions, error) {
+	// OpenWeatherMap translates the description itself
+	url := fmt.Sprintf("%s/weather?lat=%f&lon=%f&appid=%s&units=%s&lang=%s", owmApiBase, a.coord.Lat, a.coord.Lon, a.key.Value(), a.units, a.lang)
 	ret := &owCurrentConditions{}
-	err = json.Unmarshal(rspData, ret)
+	err := getJSON(ctx, a.client, owmProvider, url, nil, ret, owmError)
 	if err != nil {
 		return nil, err
 	}
@@ -171,18 +206,10 @@ func (a *owmApi) getCurrentConditions() (*owCurrentConditions, error) {
 	return ret, nil
 }
 
-func (a *owmApi) getAirPollution() (*owAirPollution, error) {
-	url := fmt.Sprintf("%s/air_pollution?lat=%f&lon=%f&appid=%s", owmApiBase, a.coord.Lat, a.coord.Lon, a.key)
-	rsp, err := a.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	rspData, err := io.ReadAll(rsp.Body)
-	if err != nil {
-		return nil, err
-	}
+func (a *owmApi) getAirPollution(ctx context.Context) (*owAirPollution, error) {
+	url := fmt.Sprintf("%s/air_pollution?lat=%f&lon=%f&appid=%s", owmApiBase, a.coord.Lat, a.coord.Lon, a.key.Value())
 	ret := &owAirPollution{}
-	err = json.Unmarshal(rspData, ret)
+	err := getJSON(ctx, a.client, owmProvider, url, nil, ret, owmError)
 	if err != nil {
 		return nil, err
 	}
@@ -190,21 +217,41 @@ func (a *owmApi) getAirPollution() (*owAirPollution, error) {
 	return ret, nil
 }
 
-func (a *owmApi) getUvIndex() (*owUvIndex, error) {
-	url := fmt.Sprintf("%s/uvi?lat=%f&lon=%f&appid=%s", owmApiBase, a.coord.Lat, a.coord.Lon, a.key)
-	rsp, err := a.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	rspData, err := io.ReadAll(rsp.Body)
-	if err != nil {
-		return nil, err
-	}
+func (a *owmApi) getUvIndex(ctx context.Context) (*owUvIndex, error) {
+	url := fmt.Sprintf("%s/uvi?lat=%f&lon=%f&appid=%s", owmApiBase, a.coord.Lat, a.coord.Lon, a.key.Value())
 	ret := &owUvIndex{}
-	err = json.Unmarshal(rspData, ret)
+	err := getJSON(ctx, a.client, owmProvider, url, nil, ret, owmError)
 	if err != nil {
 		return nil, err
 	}
 
 	return ret, nil
 }
+
+// owmCondition maps an OpenWeatherMap weather condition id to a Condition. The ids are grouped by
+// their first digit, with the exceptions handled first.
+func owmCondition(id int) Condition {
+	switch {
+	case id == 511:
+		return ConditionFreezingRain
+	case id >= 611 && id <= 616:
+		return ConditionSleet
+	case id == 701 || id == 741:
+		return ConditionFog
+	case id == 800:
+		return ConditionClear
+	case id == 801 || id == 802:
+		return ConditionPartlyCloudy
+	case id == 803 || id == 804:
+		return ConditionCloudy
+	case id >= 200 && id < 300:
+		return ConditionThunderstorm
+	case id >= 300 && id < 400:
+		return ConditionDrizzle
+	case id >= 500 && id < 600:
+		return ConditionRain
+	case id >= 600 && id < 700:
+		return ConditionSnow
+	}
+	return ConditionUnknown
+}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ErrRateLimited     = errors.New("provider request rate limit reached")
+	ErrBudgetExhausted = errors.New("provider daily request budget exhausted")
+)
+
+var (
+	apiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "The number of requests sent to each provider, excluding those served from the cache",
+	}, []string{"provider"})
+	apiRequestsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_rejected_total",
+		Help:      "The number of requests to each provider which were not sent, to stay within its quota",
+	}, []string{"provider", "reason"})
+	apiBudgetRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "api_budget_remaining",
+		Help:      "The number of requests remaining in each provider's daily budget",
+	}, []string{"provider"})
+)
+
+// The default daily request limits of each provider's free tier. A limit of zero is unlimited.
+var defaultDailyLimits = []struct {
+	key      string
+	provider string
+	limit    int
+}{
+	{key: "omet", provider: ometProvider, limit: 10000},
+	{key: "ow", provider: owmProvider, limit: 1000},
+	{key: "tio", provider: tioProvider, limit: 500},
+	{key: "wapi", provider: wapiProvider, limit: 0},
+}
+
+// QuotaTransport is an http.RoundTripper which keeps the requests made for each provider within
+// its daily budget. Requests are spread over the day with a token bucket, which refills at the
+// rate that would exactly use the daily budget, so that adding locations results in occasional
+// rejected requests rather than running out of requests part way through the day.
+type QuotaTransport struct {
+	next    http.RoundTripper
+	budgets map[string]*budget
+
+	// The budgets are saved to the state file, if there is one, so that restarts do not reset them
+	stateFile string
+	dirty     atomic.Bool // Whether a request has been made since the budgets were last saved
+	saveMu    sync.Mutex
+	saveErr   string // The last error saving the budgets, so that it is only logged when it changes
+}
+
+// NewQuotaTransport creates a QuotaTransport, which persists the budgets in stateFile so that they
+// survive restarts, or keeps them in memory only if stateFile is empty.
+func NewQuotaTransport(next http.RoundTripper, stateFile string) *QuotaTransport {
+	t := &QuotaTransport{
+		next:      next,
+		budgets:   make(map[string]*budget),
+		stateFile: stateFile,
+	}
+
+	for _, d := range defaultDailyLimits {
+		prefix := "WEX_" + strings.ToUpper(d.key)
+		limit := GetIntWithDefault(prefix+"_DAILY_LIMIT", d.limit)
+		if limit <= 0 {
+			continue
+		}
+		burst := GetIntWithDefault(prefix+"_BURST", max(limit/50, 10))
+
+		slog.Info("Limiting provider requests", "provider", d.provider, "daily", limit, "burst", burst)
+		t.budgets[d.provider] = newBudget(limit, burst)
+		apiBudgetRemaining.WithLabelValues(d.provider).Set(float64(limit))
+	}
+	t.load()
+	return t
+}
+
+// QuotaStateFile returns where the budgets are persisted within a cache directory. This is not a
+// .json file, so that it is never mistaken for a cached response and evicted.
+func QuotaStateFile(cacheDir string) string {
+	if cacheDir == "" {
+		return ""
+	}
+	return filepath.Join(cacheDir, "quota.state")
+}
+
+// load restores the budgets saved by a previous run, if any
+func (t *QuotaTransport) load() {
+	if t.stateFile == "" {
+		return
+	}
+	data, err := os.ReadFile(t.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	states := make(map[string]budgetState)
+	if err == nil {
+		err = json.Unmarshal(data, &states)
+	}
+	if err != nil {
+		slog.Warn("Unable to restore request budgets, so starting them afresh", "path", t.stateFile, "err", err)
+		return
+	}
+
+	now := time.Now()
+	for provider, b := range t.budgets {
+		if state, ok := states[provider]; ok {
+			b.restore(state)
+			apiBudgetRemaining.WithLabelValues(provider).Set(float64(b.remaining(now)))
+		}
+	}
+}
+
+// Persist saves the budgets to the state file at every interval, until ctx is done. The budgets
+// should also be saved once more at shutdown, since up to an interval's requests would be lost.
+func (t *QuotaTransport) Persist(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Save()
+		}
+	}
+}
+
+// Save writes the budgets to the state file if any requests have been made since they were last
+// saved, replacing it in one step so that a crash never leaves it partly written
+func (t *QuotaTransport) Save() {
+	if t.stateFile == "" || !t.dirty.Swap(false) {
+		return
+	}
+	states := make(map[string]budgetState)
+	for provider, b := range t.budgets {
+		states[provider] = b.state()
+	}
+
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	data, err := json.Marshal(states)
+	if err == nil {
+		tmp := t.stateFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, t.stateFile)
+		}
+	}
+
+	errStr := ""
+	if err != nil {
+		errStr = err.Error()
+		t.dirty.Store(true) // Try again next time
+	}
+	if errStr != t.saveErr {
+		if err != nil {
+			slog.Error("Unable to save request budgets", "path", t.stateFile, "err", err)
+		} else {
+			slog.Info("Saving request budgets again", "path", t.stateFile)
+		}
+		t.saveErr = errStr
+	}
+}
+
+func (t *QuotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	provider := ProviderFromContext(req.Context())
+	if provider == "" {
+		return t.next.RoundTrip(req)
+	}
+
+	if b, ok := t.budgets[provider]; ok {
+		remaining, err := b.take(time.Now())
+		if err != nil {
+			reason := "rate_limited"
+			if errors.Is(err, ErrBudgetExhausted) {
+				reason = "budget_exhausted"
+			}
+			apiRequestsRejected.WithLabelValues(provider, reason).Inc()
+			return nil, fmt.Errorf("%s: %w", provider, err)
+		}
+		apiBudgetRemaining.WithLabelValues(provider).Set(float64(remaining))
+		t.dirty.Store(true)
+	}
+
+	apiRequests.WithLabelValues(provider).Inc()
+	return t.next.RoundTrip(req)
+}
+
+// budget combines a token bucket with a daily request count, which resets at midnight UTC
+type budget struct {
+	limit int
+	burst float64
+	rate  float64 // Tokens added to the bucket per second
+
+	mu     sync.Mutex
+	tokens float64
+	filled time.Time
+	used   int
+	day    time.Time
+}
+
+func newBudget(limit int, burst int) *budget {
+	return &budget{
+		limit:  limit,
+		burst:  float64(burst),
+		rate:   float64(limit) / (24 * time.Hour).Seconds(),
+		tokens: float64(burst),
+	}
+}
+
+// budgetState is the part of a budget which is persisted across restarts
+type budgetState struct {
+	Tokens float64   `json:"tokens"`
+	Filled time.Time `json:"filled"`
+	Used   int       `json:"used"`
+	Day    time.Time `json:"day"`
+}
+
+func (b *budget) state() budgetState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return budgetState{Tokens: b.tokens, Filled: b.filled, Used: b.used, Day: b.day}
+}
+
+func (b *budget) restore(s budgetState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, s.Tokens)
+	b.filled = s.Filled
+	b.used = s.Used
+	b.day = s.Day
+}
+
+// remaining returns the number of requests left for the day, without consuming one
+func (b *budget) remaining(now time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !now.UTC().Truncate(24 * time.Hour).Equal(b.day) {
+		return b.limit
+	}
+	return max(b.limit-b.used, 0)
+}
+
+// take consumes a request from the budget if one is available, returning the number of requests
+// remaining for the day.
+func (b *budget) take(now time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if day := now.UTC().Truncate(24 * time.Hour); !day.Equal(b.day) {
+		b.day = day
+		b.used = 0
+	}
+	if !b.filled.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.filled).Seconds()*b.rate)
+	}
+	b.filled = now
+
+	if b.used >= b.limit {
+		return 0, ErrBudgetExhausted
+	}
+	if b.tokens < 1 {
+		return b.limit - b.used, ErrRateLimited
+	}
+	b.tokens--
+	b.used++
+	return b.limit - b.used, nil
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBudgetBurst(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	b := newBudget(1000, 3)
+
+	for i := 0; i < 3; i++ {
+		if _, err := b.take(now); err != nil {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+	if remaining, err := b.take(now); !errors.Is(err, ErrRateLimited) || remaining != 997 {
+		t.Errorf("expected to be rate limited with 997 remaining, got %d, %v", remaining, err)
+	}
+}
+
+func TestBudgetRefills(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	b := newBudget(24*60, 1) // One request a minute
+
+	if _, err := b.take(now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.take(now.Add(30 * time.Second)); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected to be rate limited after 30s, got %v", err)
+	}
+	if _, err := b.take(now.Add(90 * time.Second)); err != nil {
+		t.Errorf("expected the bucket to have refilled after 90s, got %v", err)
+	}
+}
+
+func TestBudgetDailyLimit(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	b := newBudget(2, 10)
+
+	for i := 0; i < 2; i++ {
+		if _, err := b.take(now); err != nil {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+	if _, err := b.take(now.Add(time.Hour)); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("expected the budget to be exhausted, got %v", err)
+	}
+
+	// The count resets at midnight UTC, whatever the time zone of the clock
+	tomorrow := time.Date(2024, 1, 16, 0, 0, 1, 0, time.UTC).In(time.FixedZone("UTC-5", -5*60*60))
+	if remaining, err := b.take(tomorrow); err != nil || remaining != 1 {
+		t.Errorf("expected the budget to reset at midnight, got %d, %v", remaining, err)
+	}
+}
+
+func TestQuotaTransportPersistsBudgets(t *testing.T) {
+	t.Setenv("WEX_OW_DAILY_LIMIT", "100")
+	file := QuotaStateFile(t.TempDir())
+
+	first := NewQuotaTransport(&flakyTransport{status: http.StatusOK}, file)
+	first.Save()
+	if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected nothing to be saved before any requests, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := first.RoundTrip(providerRequest(t, context.Background(), owmProvider)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first.Save()
+
+	second := NewQuotaTransport(http.DefaultTransport, file)
+	if remaining := second.budgets[owmProvider].remaining(time.Now()); remaining != 97 {
+		t.Errorf("expected 97 requests remaining after a restart, got %d", remaining)
+	}
+}
+
+func TestQuotaTransportInMemory(t *testing.T) {
+	transport := NewQuotaTransport(&flakyTransport{status: http.StatusOK}, "")
+	if _, err := transport.RoundTrip(providerRequest(t, context.Background(), owmProvider)); err != nil {
+		t.Fatal(err)
+	}
+	transport.Save() // Nothing to save to, and nothing to fail
+}
+
+func TestQuotaStateFile(t *testing.T) {
+	if QuotaStateFile("") != "" {
+		t.Error("expected no state file without a cache directory")
+	}
+	if filepath.Ext(QuotaStateFile("/cache")) == ".json" {
+		t.Error("expected the state file not to look like a cached response")
+	}
+}
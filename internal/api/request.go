@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gca3020/weather_exporter/internal/redact"
+)
+
+type providerKey struct{}
+
+// ProviderFromContext returns the provider on whose behalf a request is being made, or an empty
+// string if the request did not come from a provider.
+func ProviderFromContext(ctx context.Context) string {
+	provider, _ := ctx.Value(providerKey{}).(string)
+	return provider
+}
+
+// getJSON performs a GET request for a provider, with any additional headers given, and decodes the
+// JSON response into out. The request is tagged with the provider's name so that the shared
+// transport can account for it. Any failure, including an error response from the provider, is
+// returned as a *ProviderError, with any API keys redacted from the request URL.
+func getJSON(ctx context.Context, client *http.Client, provider string, url string, header http.Header, out any, decodeErr errorDecoder) error {
+	err := doGetJSON(ctx, client, provider, url, header, out, decodeErr)
+	if err != nil {
+		apiErrors.WithLabelValues(provider, ErrorKind(err)).Inc()
+	}
+	return err
+}
+
+func doGetJSON(ctx context.Context, client *http.Client, provider string, url string, header http.Header, out any, decodeErr errorDecoder) error {
+	ctx = context.WithValue(ctx, providerKey{}, provider)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &ProviderError{Provider: provider, Kind: ErrUpstream, Err: redact.Error(err)}
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		redact.Error(err)
+		kind := ErrUpstream
+		if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrBudgetExhausted) {
+			kind = ErrQuota
+		}
+		return &ProviderError{Provider: provider, Kind: kind, Err: err}
+	}
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return &ProviderError{Provider: provider, Kind: ErrUpstream, StatusCode: rsp.StatusCode, Err: err}
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		message, kind := decodeErr(body)
+		if kind == nil {
+			kind = kindFromStatus(rsp.StatusCode)
+		}
+		if message == "" {
+			message = strings.TrimSpace(rsp.Status)
+		}
+		return &ProviderError{Provider: provider, Kind: kind, StatusCode: rsp.StatusCode, Message: message}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return &ProviderError{Provider: provider, Kind: ErrUpstream, StatusCode: rsp.StatusCode, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	defaultRetryBackoff = 1 * time.Second
+	defaultRetryMaxWait = 30 * time.Second
+)
+
+var apiRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "api_retries_total",
+	Help:      "The number of requests to each provider which were retried, by the reason for the retry",
+}, []string{"provider", "reason"})
+
+// RetryTransport is an http.RoundTripper which retries requests that fail in a way that is likely
+// to be temporary, such as a network error or a 502 from the provider. Retries back off
+// exponentially with jitter, and honor the Retry-After header sent with a 429 or 503.
+type RetryTransport struct {
+	next    http.RoundTripper
+	retries int
+	base    time.Duration
+	maxWait time.Duration
+}
+
+func NewRetryTransport(next http.RoundTripper) *RetryTransport {
+	t := &RetryTransport{
+		next:    next,
+		retries: GetIntWithDefault("WEX_RETRIES", 2),
+		base:    GetDurationWithDefault("WEX_RETRY_BACKOFF", defaultRetryBackoff),
+		maxWait: GetDurationWithDefault("WEX_RETRY_MAX_WAIT", defaultRetryMaxWait),
+	}
+	if t.retries < 0 {
+		configProblem("WEX_RETRIES", "%d is negative, so requests will not be retried", t.retries)
+		t.retries = 0
+	}
+	if t.base < 0 {
+		configProblem("WEX_RETRY_BACKOFF", "%v is negative, using the default of %v", t.base, defaultRetryBackoff)
+		t.base = defaultRetryBackoff
+	}
+	if t.maxWait < 0 {
+		configProblem("WEX_RETRY_MAX_WAIT", "%v is negative, using the default of %v", t.maxWait, defaultRetryMaxWait)
+		t.maxWait = defaultRetryMaxWait
+	}
+	return t
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	provider := ProviderFromContext(req.Context())
+
+	for attempt := 0; ; attempt++ {
+		rsp, err := t.next.RoundTrip(req)
+		// A request abandoned along with its scrape is not retried, so is not counted as one
+		if req.Context().Err() != nil {
+			return rsp, err
+		}
+		reason := retryReason(rsp, err)
+		if reason == "" || attempt >= t.retries {
+			return rsp, err
+		}
+
+		wait := t.backoff(attempt)
+		if rsp != nil {
+			if after, ok := retryAfter(rsp.Header); ok {
+				wait = after
+			}
+		}
+		if wait > t.maxWait {
+			// The provider wants us to stay away for longer than we are prepared to wait
+			return rsp, err
+		}
+		if rsp != nil {
+			io.Copy(io.Discard, rsp.Body)
+			rsp.Body.Close()
+		}
+
+		slog.Debug("Retrying provider request", "provider", provider, "reason", reason, "attempt", attempt+1, "wait", wait)
+		apiRetries.WithLabelValues(provider, reason).Inc()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a random wait of up to base * 2^attempt, capped at the maximum wait
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	ceiling := t.base << attempt
+	if ceiling <= 0 || ceiling > t.maxWait {
+		ceiling = t.maxWait
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryReason returns why a request should be retried, or an empty string if it should not be
+func retryReason(rsp *http.Response, err error) string {
+	if err != nil {
+		// Requests rejected to stay within quota will not succeed on an immediate retry
+		if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrBudgetExhausted) {
+			return ""
+		}
+		return "error"
+	}
+
+	switch rsp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return strconv.Itoa(rsp.StatusCode)
+	}
+	return ""
+}
+
+// retryAfter parses a Retry-After header, which may be either a number of seconds or a date
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// flakyTransport fails every request with err, or responds with status if err is nil
+type flakyTransport struct {
+	err      error
+	status   int
+	requests int
+}
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	if t.err != nil {
+		return nil, t.err
+	}
+	return &http.Response{StatusCode: t.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func retries(t *testing.T, provider string, reason string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := apiRetries.WithLabelValues(provider, reason).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func providerRequest(t *testing.T, ctx context.Context, provider string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, providerKey{}, provider), http.MethodGet, "https://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestRetryTransportRetries(t *testing.T) {
+	next := &flakyTransport{status: http.StatusBadGateway}
+	transport := &RetryTransport{next: next, retries: 2, base: time.Millisecond, maxWait: time.Second}
+
+	rsp, err := transport.RoundTrip(providerRequest(t, context.Background(), "RetryTest"))
+	if err != nil || rsp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected the last response once out of retries, got %v, %v", rsp, err)
+	}
+	if next.requests != 3 || retries(t, "RetryTest", "502") != 2 {
+		t.Errorf("expected 3 requests and 2 retries, got %d and %v", next.requests, retries(t, "RetryTest", "502"))
+	}
+}
+
+func TestRetryTransportAbandonedRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	next := &flakyTransport{err: context.Canceled}
+	transport := &RetryTransport{next: next, retries: 2, base: time.Millisecond, maxWait: time.Second}
+	if _, err := transport.RoundTrip(providerRequest(t, ctx, "AbandonTest")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancellation, got %v", err)
+	}
+	if next.requests != 1 || retries(t, "AbandonTest", "error") != 0 {
+		t.Errorf("expected a cancelled request not to be retried or counted, got %d request(s) and %v retries", next.requests, retries(t, "AbandonTest", "error"))
+	}
+}
+
+func TestRetryTransportNegativeSettings(t *testing.T) {
+	t.Setenv("WEX_RETRIES", "-1")
+	t.Setenv("WEX_RETRY_BACKOFF", "-1s")
+	t.Setenv("WEX_RETRY_MAX_WAIT", "-1s")
+	ResetConfigProblems()
+	t.Cleanup(ResetConfigProblems)
+
+	transport := NewRetryTransport(http.DefaultTransport)
+	if transport.retries != 0 || transport.base != defaultRetryBackoff || transport.maxWait != defaultRetryMaxWait {
+		t.Errorf("expected negative settings to be replaced, got %+v", transport)
+	}
+	if problems := ConfigProblems(); len(problems) != 3 {
+		t.Errorf("expected 3 problems, got %v", problems)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	transport := &RetryTransport{base: time.Second, maxWait: 5 * time.Second}
+	for attempt := 0; attempt < 70; attempt++ {
+		if wait := transport.backoff(attempt); wait < 0 || wait > 5*time.Second {
+			t.Errorf("attempt %d: expected a wait of up to 5s, got %v", attempt, wait)
+		}
+	}
+
+	// A zero maximum wait retries immediately
+	transport.maxWait = 0
+	if wait := transport.backoff(3); wait != 0 {
+		t.Errorf("expected no wait, got %v", wait)
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gca3020/weather_exporter/internal/redact"
+)
+
+// Secret is a value such as an API key, which can either be set directly in an environment
+// variable, or read from the file named by the same variable with a _FILE suffix (as used for
+// Docker and Kubernetes secrets). Files are read again whenever they change, so that a rotated key
+// is picked up without a restart.
+type Secret struct {
+	env  string
+	path string
+
+	mu      sync.Mutex
+	value   string
+	modTime time.Time
+	failing bool // Whether the file could not be read last time, so that this is only logged once
+}
+
+// GetSecret reads a secret from ENV, or from the file named by ENV_FILE if that is set instead
+func GetSecret(env string) *Secret {
+	s := &Secret{env: env}
+
+	if path := GetStringWithDefault(env+"_FILE", ""); path != "" {
+		if _, ok := lookup(env); ok {
+			configProblem(env, "both %s and %s_FILE are set, using the file", env, env)
+		}
+		if _, err := os.Stat(path); err != nil {
+			configProblem(env+"_FILE", "unable to read secret file: %v", err)
+		}
+		s.path = path
+		s.Value()
+		return s
+	}
+
+	s.value = GetStringWithDefault(env, "")
+	redact.Secret(s.value)
+	return s
+}
+
+// Value returns the current value of the secret
+func (s *Secret) Value() string {
+	if s.path == "" {
+		return s.value
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		s.fail(err)
+		return s.value
+	}
+	if info.ModTime().Equal(s.modTime) && !s.failing {
+		return s.value
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		s.fail(err)
+		return s.value
+	}
+	if s.failing {
+		slog.Info("Secret file can be read again", "env", s.env+"_FILE", "path", s.path)
+		s.failing = false
+	}
+
+	if !s.modTime.IsZero() {
+		slog.Info("Secret file changed, reloading", "env", s.env+"_FILE", "path", s.path)
+	}
+	s.value = strings.TrimSpace(string(data))
+	s.modTime = info.ModTime()
+	redact.Secret(s.value)
+	return s.value
+}
+
+// fail logs that the file could not be read, unless that was already the case last time, since the
+// secret is read for every request made with it
+func (s *Secret) fail(err error) {
+	if !s.failing {
+		slog.Error("Unable to read secret file, using the last value read", "env", s.env+"_FILE", "path", s.path, "err", err)
+		s.failing = true
+	}
+}
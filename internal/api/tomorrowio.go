@@ -1,13 +1,13 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 const (
@@ -18,30 +18,47 @@ const (
 type tioFactory struct {
 }
 
+func (f *tioFactory) Key() string {
+	return "tio"
+}
+
 func (f *tioFactory) Build(client *http.Client) (apis []WeatherApi) {
 	coordinates := GetCoordinates("WEX_TIO_COORDS")
-	apiKey := GetStringWithDefault("WEX_TIO_APIKEY", "")
 
 	for _, coord := range coordinates {
-		slog.Info("Creating new Tomorrow.io API", "coord", coord)
-		apis = append(apis, &tioApi{client: client, key: apiKey, coord: coord, units: "metric"})
+		apis = append(apis, f.New(client, coord))
 	}
 	return
 }
 
+func (f *tioFactory) New(client *http.Client, coord Coordinate) WeatherApi {
+	apiKey := GetSecret("WEX_TIO_APIKEY")
+	if apiKey.Value() == "" {
+		configProblem("WEX_TIO_APIKEY", "no API key is set for the configured locations")
+	}
+
+	slog.Info("Creating new Tomorrow.io API", "coord", coord)
+	return withTTL(&tioApi{client: client, key: apiKey, coord: coord, units: "metric", lang: GetLanguage()}, cacheTTL(f, coord))
+}
+
 func init() {
 	factories = append(factories, &tioFactory{})
 }
 
 type tioApi struct {
 	client *http.Client
-	key    string
+	key    *Secret
 	coord  Coordinate
 	units  string
+	lang   string
 }
 
-func (a *tioApi) GetCurrentConditions() (*CurrentConditions, error) {
-	c, err := a.getCore()
+func (a *tioApi) Target() Target {
+	return Target{Provider: tioProvider, Coordinates: a.coord.String()}
+}
+
+func (a *tioApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	c, err := a.getCore(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -49,13 +66,15 @@ func (a *tioApi) GetCurrentConditions() (*CurrentConditions, error) {
 	return &CurrentConditions{
 		Provider:      tioProvider,
 		LocationName:  c.Location.Name,
-		Coordinates:   fmt.Sprintf("%v,%v", a.coord.Lat, a.coord.Lon),
-		Description:   tioCodeToString(c.Data.Values.WeatherCode),
+		Coordinates:   a.coord.String(),
+		ObservedAt:    c.Data.Time,
+		Description:   tioCodeToString(a.lang, c.Data.Values.WeatherCode),
+		Condition:     tioCondition(c.Data.Values.WeatherCode),
 		Temp:          c.Data.Values.Temperature,
 		FeelsLike:     c.Data.Values.FeelsLike,
 		Humidity:      c.Data.Values.Humidity,
 		PressureGnd:   c.Data.Values.PressureSurface,
-		PressureSea:   c.Data.Values.PressureSea, // This appears to be missing from the Realtime API
+		PressureSea:   orMissing(c.Data.Values.PressureSea), // This appears to be missing from the Realtime API
 		Visibility:    c.Data.Values.Visibility * 1000,
 		WindSpeed:     c.Data.Values.WindSpeed,
 		WindDirection: c.Data.Values.WindDirection,
@@ -66,37 +85,38 @@ func (a *tioApi) GetCurrentConditions() (*CurrentConditions, error) {
 		UvIndex:       c.Data.Values.UvIndex,
 
 		// Air Quality APIs are a Premium subscription, so this is not currently implemented
-		//	AqIndex:
-		//	CO:
-		//	NO:
-		//	NO2:
-		//	O3:
-		//	SO2:
-		//	NH3:
-		//	Pm2p5:
-		//	Pm10:
+		AqIndex: Missing,
+		CO:      Missing,
+		NO:      Missing,
+		NO2:     Missing,
+		O3:      Missing,
+		SO2:     Missing,
+		NH3:     Missing,
+		Pm2p5:   Missing,
+		Pm10:    Missing,
 	}, nil
 }
 
 type tioCore struct {
 	Data struct {
+		Time   time.Time `json:"time"`
 		Values struct {
-			Temperature           float64 `json:"temperature"`
-			FeelsLike             float64 `json:"temperatureApparent"`
-			CloudCover            float64 `json:"cloudCover"`
-			Humidity              float64 `json:"humidity"`
-			PressureSurface       float64 `json:"pressureSurfaceLevel"`
-			PressureSea           float64 `json:"pressureSeaLevel"`
-			RainIntensity         float64 `json:"rainIntensity"`
-			FreezingRainIntensity float64 `json:"freezingRainIntensity"`
-			SleetIntensity        float64 `json:"sleetIntensity"`
-			SnowIntensity         float64 `json:"snowIntensity"`
-			WindSpeed             float64 `json:"windSpeed"`
-			WindDirection         float64 `json:"windDirection"`
-			WindGust              float64 `json:"windGust"`
-			Visibility            float64 `json:"visibility"`
-			UvIndex               float64 `json:"uvIndex"`
-			WeatherCode           int     `json:"weatherCode"`
+			Temperature           float64  `json:"temperature"`
+			FeelsLike             float64  `json:"temperatureApparent"`
+			CloudCover            float64  `json:"cloudCover"`
+			Humidity              float64  `json:"humidity"`
+			PressureSurface       float64  `json:"pressureSurfaceLevel"`
+			PressureSea           *float64 `json:"pressureSeaLevel"`
+			RainIntensity         float64  `json:"rainIntensity"`
+			FreezingRainIntensity float64  `json:"freezingRainIntensity"`
+			SleetIntensity        float64  `json:"sleetIntensity"`
+			SnowIntensity         float64  `json:"snowIntensity"`
+			WindSpeed             float64  `json:"windSpeed"`
+			WindDirection         float64  `json:"windDirection"`
+			WindGust              float64  `json:"windGust"`
+			Visibility            float64  `json:"visibility"`
+			UvIndex               float64  `json:"uvIndex"`
+			WeatherCode           int      `json:"weatherCode"`
 		} `json:"values"`
 	} `json:"data"`
 	Location struct {
@@ -106,29 +126,31 @@ type tioCore struct {
 	} `json:"location"`
 }
 
-func (a *tioApi) getCore() (*tioCore, error) {
-	url := fmt.Sprintf("%s?location=%s&apikey=%s&units=%s",
+// Tomorrow.io errors look like {"code":401001,"type":"Invalid Auth","message":"..."}
+func tioError(body []byte) (string, error) {
+	e := struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}{}
+	json.Unmarshal(body, &e)
+	if e.Type == "" {
+		return e.Message, nil
+	}
+	return e.Type + ": " + e.Message, nil
+}
+
+func (a *tioApi) getCore(ctx context.Context) (*tioCore, error) {
+	url := fmt.Sprintf("%s?location=%s&units=%s",
 		tioApiBase,
 		url.QueryEscape(fmt.Sprintf("%v,%v", a.coord.Lat, a.coord.Lon)),
-		a.key,
 		a.units,
 	)
-	rsp, err := a.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-
-	if rsp.StatusCode != 200 {
-		slog.Error("Invalid status code", "code", rsp.StatusCode, "status", rsp.Status)
-		return nil, errors.New("invalid response status code")
-	}
 
-	rspData, err := io.ReadAll(rsp.Body)
-	if err != nil {
-		return nil, err
-	}
+	// Tomorrow.io accepts the key as a header, which keeps it out of the URL altogether
+	header := http.Header{}
+	header.Set("apikey", a.key.Value())
 	ret := &tioCore{}
-	err = json.Unmarshal(rspData, ret)
+	err := getJSON(ctx, a.client, tioProvider, url, header, ret, tioError)
 	if err != nil {
 		return nil, err
 	}
@@ -163,9 +185,93 @@ var tioCodeMap = map[int]string{
 	8000: "Thunderstorm",
 }
 
-func tioCodeToString(code int) string {
-	if str, ok := tioCodeMap[code]; ok {
+// The Realtime API does not translate its weather codes, so the descriptions are translated here
+var tioCodeMaps = map[string]map[int]string{
+	"en": tioCodeMap,
+	"de": {
+		0:    "Unbekannt",
+		1000: "Klar, sonnig",
+		1100: "Überwiegend klar",
+		1101: "Teilweise bewölkt",
+		1102: "Überwiegend bewölkt",
+		1001: "Bewölkt",
+		2000: "Nebel",
+		2100: "Leichter Nebel",
+		4000: "Nieselregen",
+		4001: "Regen",
+		4200: "Leichter Regen",
+		4201: "Starker Regen",
+		5000: "Schnee",
+		5001: "Schneegestöber",
+		5100: "Leichter Schneefall",
+		5101: "Starker Schneefall",
+		6000: "Gefrierender Nieselregen",
+		6001: "Gefrierender Regen",
+		6200: "Leichter gefrierender Regen",
+		6201: "Starker gefrierender Regen",
+		7000: "Eiskörner",
+		7101: "Starker Eiskörnerfall",
+		7102: "Leichter Eiskörnerfall",
+		8000: "Gewitter",
+	},
+	"ja": {
+		0:    "不明",
+		1000: "快晴",
+		1100: "晴れ",
+		1101: "一部曇り",
+		1102: "おおむね曇り",
+		1001: "曇り",
+		2000: "霧",
+		2100: "もや",
+		4000: "霧雨",
+		4001: "雨",
+		4200: "弱い雨",
+		4201: "強い雨",
+		5000: "雪",
+		5001: "にわか雪",
+		5100: "弱い雪",
+		5101: "強い雪",
+		6000: "着氷性の霧雨",
+		6001: "着氷性の雨",
+		6200: "弱い着氷性の雨",
+		6201: "強い着氷性の雨",
+		7000: "凍雨",
+		7101: "強い凍雨",
+		7102: "弱い凍雨",
+		8000: "雷雨",
+	},
+}
+
+func tioCodeToString(lang string, code int) string {
+	if str, ok := describe(tioCodeMaps, lang, code); ok {
 		return str
 	}
 	return fmt.Sprintf("Unknown (%d)", code)
 }
+
+// tioCondition maps a Tomorrow.io weather code to a Condition
+func tioCondition(code int) Condition {
+	switch code {
+	case 1000, 1100:
+		return ConditionClear
+	case 1101:
+		return ConditionPartlyCloudy
+	case 1001, 1102:
+		return ConditionCloudy
+	case 2000, 2100:
+		return ConditionFog
+	case 4000:
+		return ConditionDrizzle
+	case 4001, 4200, 4201:
+		return ConditionRain
+	case 6000, 6001, 6200, 6201:
+		return ConditionFreezingRain
+	case 7000, 7101, 7102:
+		return ConditionSleet
+	case 5000, 5001, 5100, 5101:
+		return ConditionSnow
+	case 8000:
+		return ConditionThunderstorm
+	}
+	return ConditionUnknown
+}
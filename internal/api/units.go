@@ -0,0 +1,141 @@
+package api
+
+import (
+	"strings"
+)
+
+// Unit is one of the units a measurement can be reported in
+type Unit struct {
+	Name        string                // Name of the unit, as used in settings and metric name suffixes (e.g. "fahrenheit")
+	Symbol      string                // Abbreviation of the unit, for display (e.g. "°F")
+	Description string                // Name of the unit, for help text (e.g. "Fahrenheit")
+	Base        bool                  // Whether this is the unit measurements are normalized to
+	Convert     func(float64) float64 // Converts a measurement from the unit it is normalized to
+}
+
+func identity(v float64) float64 { return v }
+
+// quantity is a kind of measurement which can be reported in different units, the first of which
+// is the unit measurements are normalized to
+type quantity struct {
+	env      string
+	imperial string
+	fields   []string
+	units    []Unit
+}
+
+var quantities = []quantity{
+	{
+		env:      "WEX_UNITS_TEMPERATURE",
+		imperial: "fahrenheit",
+		fields:   []string{"temperature", "feelslike"},
+		units: []Unit{
+			{Name: "celsius", Symbol: "°C", Description: "Celsius", Base: true, Convert: identity},
+			{Name: "fahrenheit", Symbol: "°F", Description: "Fahrenheit", Convert: func(v float64) float64 { return v*9/5 + 32 }},
+		},
+	},
+	{
+		env:      "WEX_UNITS_SPEED",
+		imperial: "mph",
+		fields:   []string{"wind_speed", "wind_gust"},
+		units: []Unit{
+			{Name: "meters_per_second", Symbol: "m/s", Description: "meters/second", Base: true, Convert: identity},
+			{Name: "kph", Symbol: "km/h", Description: "kilometers/hour", Convert: func(v float64) float64 { return v * 3.6 }},
+			{Name: "mph", Symbol: "mph", Description: "miles/hour", Convert: func(v float64) float64 { return v * 3600 / 1609.344 }},
+			{Name: "knots", Symbol: "kn", Description: "knots", Convert: func(v float64) float64 { return v * 3600 / 1852 }},
+		},
+	},
+	{
+		env:      "WEX_UNITS_PRESSURE",
+		imperial: "inhg",
+		fields:   []string{"pressure_msl", "pressure_surface"},
+		units: []Unit{
+			{Name: "hpa", Symbol: "hPa", Description: "hPa", Base: true, Convert: identity},
+			{Name: "pascals", Symbol: "Pa", Description: "pascals", Convert: func(v float64) float64 { return v * 100 }},
+			{Name: "inhg", Symbol: "inHg", Description: "inches of mercury", Convert: func(v float64) float64 { return v * 100 / 3386.389 }},
+			{Name: "mmhg", Symbol: "mmHg", Description: "millimeters of mercury", Convert: func(v float64) float64 { return v * 100 / 133.322387415 }},
+		},
+	},
+	{
+		env:      "WEX_UNITS_PRECIPITATION",
+		imperial: "inches",
+		fields:   []string{"rain", "snow"},
+		units: []Unit{
+			{Name: "mm", Symbol: "mm", Description: "mm", Base: true, Convert: identity},
+			{Name: "inches", Symbol: "in", Description: "inches", Convert: func(v float64) float64 { return v / 25.4 }},
+		},
+	},
+	{
+		env:      "WEX_UNITS_DISTANCE",
+		imperial: "miles",
+		fields:   []string{"visibility"},
+		units: []Unit{
+			{Name: "meters", Symbol: "m", Description: "meters", Base: true, Convert: identity},
+			{Name: "kilometers", Symbol: "km", Description: "kilometers", Convert: func(v float64) float64 { return v / 1000 }},
+			{Name: "miles", Symbol: "mi", Description: "miles", Convert: func(v float64) float64 { return v / 1609.344 }},
+		},
+	},
+}
+
+// Units holds the unit each measurement is reported in, keyed by field name. Measurements which
+// can only be reported in one unit (such as humidity) are not included.
+type Units map[string]Unit
+
+// GetUnits reads the units to report measurements in from WEX_UNITS, which selects either the
+// "metric" or "imperial" system, and the WEX_UNITS_<QUANTITY> settings, which override the system
+// for a single kind of measurement.
+func GetUnits() Units {
+	system := strings.ToLower(GetStringWithDefault("WEX_UNITS", "metric"))
+	if system != "metric" && system != "imperial" {
+		configProblem("WEX_UNITS", "unknown unit system %q, expected metric or imperial", system)
+		system = "metric"
+	}
+
+	units := make(Units)
+	for _, q := range quantities {
+		name := q.units[0].Name
+		if system == "imperial" {
+			name = q.imperial
+		}
+		name = strings.ToLower(GetStringWithDefault(q.env, name))
+
+		unit, ok := q.find(name)
+		if !ok {
+			configProblem(q.env, "unknown unit %q, expected one of %s", name, strings.Join(q.names(), ", "))
+			unit = q.units[0]
+		}
+		for _, field := range q.fields {
+			units[field] = unit
+		}
+	}
+	return units
+}
+
+func (q *quantity) find(name string) (Unit, bool) {
+	for _, u := range q.units {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return Unit{}, false
+}
+
+func (q *quantity) names() []string {
+	names := make([]string, 0, len(q.units))
+	for _, u := range q.units {
+		names = append(names, u.Name)
+	}
+	return names
+}
+
+// Convert returns a copy of the conditions, with every measurement converted to its reporting unit
+func (u Units) Convert(cc *CurrentConditions) *CurrentConditions {
+	converted := *cc
+	for _, f := range Fields {
+		if unit, ok := u[f.Name]; ok {
+			v := f.Value(&converted)
+			*v = unit.Convert(*v)
+		}
+	}
+	return &converted
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	namespace = "weather"
+
+	// Number of consecutive polls a sudden change must persist for before it is believed
+	jumpConfirmations = 3
+)
+
+var validationRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "validation_rejections_total",
+	Help:      "The number of provider readings rejected as physically implausible",
+}, []string{"provider", "field", "reason"})
+
+type validationRule struct {
+	min, max float64
+	jump     bool // Whether to reject sudden changes between polls
+}
+
+// The plausible range for each measurement. Surface pressure gets a wider range than sea-level
+// pressure, since it falls well below 850 hPa at high altitude.
+var validationRules = map[string]validationRule{
+	"temperature":      {min: -90, max: 60, jump: true},
+	"feelslike":        {min: -100, max: 70, jump: true},
+	"humidity":         {min: 0, max: 100},
+	"pressure_msl":     {min: 850, max: 1090},
+	"pressure_surface": {min: 300, max: 1090},
+	"visibility":       {min: 1, max: math.Inf(1)},
+	"wind_speed":       {min: 0, max: 120},
+	"wind_dir":         {min: 0, max: 360},
+	"wind_gust":        {min: 0, max: 150},
+	"cloud_pct":        {min: 0, max: 100},
+	"rain":             {min: 0, max: 500},
+	"snow":             {min: 0, max: 500},
+	"uv_index":         {min: 0, max: 30},
+	"aq_index":         {min: 0, max: 500},
+	"co_conc":          {min: 0, max: math.Inf(1)},
+	"no_conc":          {min: 0, max: math.Inf(1)},
+	"no2_conc":         {min: 0, max: math.Inf(1)},
+	"o3_conc":          {min: 0, max: math.Inf(1)},
+	"so2_conc":         {min: 0, max: math.Inf(1)},
+	"nh3_conc":         {min: 0, max: math.Inf(1)},
+	"pm2p5_conc":       {min: 0, max: math.Inf(1)},
+	"pm10_conc":        {min: 0, max: math.Inf(1)},
+}
+
+func buildValidation(apis []WeatherApi) []WeatherApi {
+	maxJump := float64(GetIntWithDefault("WEX_VALIDATION_MAX_JUMP", 20))
+	if !GetBoolWithDefault("WEX_VALIDATION", true) {
+		return apis
+	}
+
+	for i, api := range apis {
+		apis[i] = &validatingApi{
+			api:     api,
+			maxJump: maxJump,
+			last:    make(map[string]float64),
+			jumps:   make(map[string]jump),
+		}
+	}
+	return apis
+}
+
+// validatingApi rejects implausible readings from the API it wraps, replacing them with Missing so
+// that they are never reported.
+type validatingApi struct {
+	api     WeatherApi
+	maxJump float64
+
+	mu    sync.Mutex
+	last  map[string]float64 // The last accepted value of each field subject to jump detection
+	jumps map[string]jump    // The readings of each field rejected as a jump since the last accepted value
+}
+
+// jump tracks the consecutive readings of a field which were rejected as a sudden change. Responses
+// are cached, so the same reading is usually seen on several polls, and only a new reading counts
+// towards confirming the change.
+type jump struct {
+	readings   int       // The number of distinct readings rejected
+	value      float64   // The last reading rejected
+	observedAt time.Time // When the last reading rejected was observed
+}
+
+func (a *validatingApi) Target() Target {
+	return a.api.Target()
+}
+
+func (a *validatingApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	cc, err := a.api.GetCurrentConditions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, f := range Fields {
+		v := f.Value(cc)
+		if IsMissing(*v) {
+			continue
+		}
+		if reason := a.check(f.Name, *v, cc.ObservedAt); reason != "" {
+			slog.Warn("Rejected implausible reading", "provider", cc.Provider, "coordinates", cc.Coordinates, "field", f.Name, "value", *v, "reason", reason)
+			validationRejections.WithLabelValues(cc.Provider, f.Name, reason).Inc()
+			*v = Missing
+			if cc.Rejected == nil {
+				cc.Rejected = make(map[string]bool)
+			}
+			cc.Rejected[f.Name] = true
+		}
+	}
+	return cc, nil
+}
+
+// check returns the reason a value should be rejected, or an empty string if it is plausible
+func (a *validatingApi) check(field string, v float64, observedAt time.Time) string {
+	rule, ok := validationRules[field]
+	if !ok {
+		return ""
+	}
+	if v < rule.min {
+		return "below_min"
+	}
+	if v > rule.max {
+		return "above_max"
+	}
+	if !rule.jump {
+		return ""
+	}
+
+	// A large change from the last accepted value is rejected, unless it persists across enough
+	// new readings that it is more likely a genuine change than a glitch. A reading is new if it
+	// was observed at a different time or has a different value, since not every provider says
+	// when it was observed.
+	last, ok := a.last[field]
+	if ok && math.Abs(v-last) > a.maxJump {
+		j := a.jumps[field]
+		if j.readings == 0 || v != j.value || !observedAt.Equal(j.observedAt) {
+			j = jump{readings: j.readings + 1, value: v, observedAt: observedAt}
+			a.jumps[field] = j
+		}
+		if j.readings < jumpConfirmations {
+			return "jump"
+		}
+	}
+	a.last[field] = v
+	delete(a.jumps, field)
+	return ""
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// stubApi returns the next of a fixed series of conditions on every poll
+type stubApi struct {
+	conditions []*CurrentConditions
+}
+
+func (a *stubApi) Target() Target {
+	return Target{Provider: "Stub", Coordinates: "0,0"}
+}
+
+func (a *stubApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	cc := a.conditions[0]
+	a.conditions = a.conditions[1:]
+	return cc, nil
+}
+
+// reading is a poll returning a single field, observed at the given minute
+type reading struct {
+	field    string
+	value    float64
+	minute   int
+	rejected bool // Whether the reading should be rejected
+}
+
+func (r reading) conditions() *CurrentConditions {
+	cc := &CurrentConditions{Provider: "Stub", Coordinates: "0,0"}
+	for _, f := range Fields {
+		*f.Value(cc) = Missing
+	}
+	for _, f := range Fields {
+		if f.Name == r.field {
+			*f.Value(cc) = r.value
+		}
+	}
+	cc.ObservedAt = time.Date(2024, 1, 15, 12, r.minute, 0, 0, time.UTC)
+	return cc
+}
+
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		readings []reading
+	}{
+		{"plausible readings", []reading{
+			{"humidity", 0, 0, false},
+			{"humidity", 100, 1, false},
+			{"pressure_msl", 1013, 2, false},
+		}},
+		{"out of range", []reading{
+			{"humidity", 101, 0, true},
+			{"pressure_msl", 0, 1, true},
+			{"wind_speed", -1, 2, true},
+			{"visibility", 0, 3, true},
+		}},
+		{"jump rejected until confirmed by new readings", []reading{
+			{"temperature", 10, 0, false},
+			{"temperature", 35, 1, true},
+			{"temperature", 35, 1, true}, // The same cached reading does not count towards confirming it
+			{"temperature", 35, 2, true},
+			{"temperature", 35, 3, false},
+			{"temperature", 36, 4, false},
+		}},
+		{"jump that does not persist", []reading{
+			{"temperature", 10, 0, false},
+			{"temperature", 35, 1, true},
+			{"temperature", 11, 2, false},
+			{"temperature", 35, 3, true},
+		}},
+		{"missing reading keeps the history", []reading{
+			{"temperature", 10, 0, false},
+			{"humidity", 50, 1, false}, // Temperature is missing from this poll
+			{"temperature", 35, 2, true},
+			{"humidity", 50, 3, false},
+			{"temperature", 35, 4, true},
+			{"temperature", 35, 5, false},
+		}},
+		{"small changes are not jumps", []reading{
+			{"temperature", 10, 0, false},
+			{"temperature", 25, 1, false},
+			{"temperature", 40, 2, false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubApi{}
+			for _, r := range tt.readings {
+				stub.conditions = append(stub.conditions, r.conditions())
+			}
+			api := &validatingApi{api: stub, maxJump: 20, last: make(map[string]float64), jumps: make(map[string]jump)}
+
+			for i, r := range tt.readings {
+				cc, err := api.GetCurrentConditions(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, f := range Fields {
+					v := *f.Value(cc)
+					switch {
+					case f.Name != r.field:
+						if !IsMissing(v) || cc.Rejected[f.Name] {
+							t.Errorf("reading %d: expected %s to be missing but not rejected", i, f.Name)
+						}
+					case r.rejected:
+						if !IsMissing(v) || !cc.Rejected[f.Name] {
+							t.Errorf("reading %d: expected %s=%v to be rejected", i, f.Name, r.value)
+						}
+					default:
+						if v != r.value || cc.Rejected[f.Name] {
+							t.Errorf("reading %d: expected %s=%v to be accepted, got %v", i, f.Name, r.value, v)
+						}
+					}
+				}
+			}
+		})
+	}
+}
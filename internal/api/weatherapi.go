@@ -1,10 +1,9 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -18,29 +17,46 @@ const (
 type wapiFactory struct {
 }
 
+func (f *wapiFactory) Key() string {
+	return "wapi"
+}
+
 func (f *wapiFactory) Build(client *http.Client) (apis []WeatherApi) {
 	coordinates := GetCoordinates("WEX_WAPI_COORDS")
-	apiKey := GetStringWithDefault("WEX_WAPI_APIKEY", "")
 
 	for _, coord := range coordinates {
-		slog.Info("Creating new WeatherAPI API", "coord", coord)
-		apis = append(apis, &wapiApi{client: client, key: apiKey, coord: coord})
+		apis = append(apis, f.New(client, coord))
 	}
 	return
 }
 
+func (f *wapiFactory) New(client *http.Client, coord Coordinate) WeatherApi {
+	apiKey := GetSecret("WEX_WAPI_APIKEY")
+	if apiKey.Value() == "" {
+		configProblem("WEX_WAPI_APIKEY", "no API key is set for the configured locations")
+	}
+
+	slog.Info("Creating new WeatherAPI API", "coord", coord)
+	return withTTL(&wapiApi{client: client, key: apiKey, coord: coord, lang: GetLanguage()}, cacheTTL(f, coord))
+}
+
 func init() {
 	factories = append(factories, &wapiFactory{})
 }
 
 type wapiApi struct {
 	client *http.Client
-	key    string
+	key    *Secret
 	coord  Coordinate
+	lang   string
 }
 
-func (a *wapiApi) GetCurrentConditions() (*CurrentConditions, error) {
-	c, err := a.getCurrent()
+func (a *wapiApi) Target() Target {
+	return Target{Provider: wapiProvider, Coordinates: a.coord.String()}
+}
+
+func (a *wapiApi) GetCurrentConditions(ctx context.Context) (*CurrentConditions, error) {
+	c, err := a.getCurrent(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -56,14 +72,16 @@ func (a *wapiApi) GetCurrentConditions() (*CurrentConditions, error) {
 	}
 
 	return &CurrentConditions{
-		Provider:     wapiProvider,
-		LocationName: c.Location.Name,
-		Coordinates:  fmt.Sprintf("%v,%v", a.coord.Lat, a.coord.Lon),
-		Description:  c.Current.Condition.Text,
-		Temp:         c.Current.TempInC,
-		FeelsLike:    c.Current.FeelsLike,
-		Humidity:     c.Current.Humidity,
-		//PressureGnd:   // This appears to be missing from the Realtime API
+		Provider:      wapiProvider,
+		LocationName:  c.Location.Name,
+		Coordinates:   a.coord.String(),
+		ObservedAt:    unixTime(c.Current.LastUpdated),
+		Description:   c.Current.Condition.Text,
+		Condition:     wapiCondition(c.Current.Condition.Code),
+		Temp:          c.Current.TempInC,
+		FeelsLike:     c.Current.FeelsLike,
+		Humidity:      c.Current.Humidity,
+		PressureGnd:   Missing, // This appears to be missing from the Realtime API
 		PressureSea:   c.Current.PressureSeaLevel,
 		Visibility:    c.Current.Visibility * 1000,
 		WindSpeed:     c.Current.WindSpeed * (5.0 / 18.0), // Convert kmph to m/s
@@ -80,8 +98,8 @@ func (a *wapiApi) GetCurrentConditions() (*CurrentConditions, error) {
 		SO2:           c.Current.AirQuality.SO2,
 		Pm2p5:         c.Current.AirQuality.Pm2p5,
 		Pm10:          c.Current.AirQuality.Pm10,
-		// NO: // Not Available from WeatherAPI
-		// NH3: // Not Available from WeatherAPI
+		NO:            Missing, // Not Available from WeatherAPI
+		NH3:           Missing, // Not Available from WeatherAPI
 	}, nil
 }
 
@@ -92,6 +110,7 @@ type wapiCurrent struct {
 		Lon  float64 `json:"lon"`
 	} `json:"location"`
 	Current struct {
+		LastUpdated      int64   `json:"last_updated_epoch"`
 		TempInC          float64 `json:"temp_c"`
 		FeelsLike        float64 `json:"feelslike_c"`
 		Humidity         float64 `json:"humidity"`
@@ -99,7 +118,7 @@ type wapiCurrent struct {
 		WindDir          float64 `json:"wind_degree"`
 		WindGust         float64 `json:"gust_kph"`
 		Visibility       float64 `json:"vis_km"`
-		PressureSeaLevel float64 `json:"presure_mb"`
+		PressureSeaLevel float64 `json:"pressure_mb"`
 		Precip           float64 `json:"precip_mm"`
 		Clouds           float64 `json:"cloud"`
 		UvIndex          float64 `json:"uv"`
@@ -119,32 +138,72 @@ type wapiCurrent struct {
 	} `json:"current"`
 }
 
-func (a *wapiApi) getCurrent() (*wapiCurrent, error) {
+// WeatherAPI errors look like {"error":{"code":1006,"message":"No matching location found."}}, and
+// are mostly returned with a 400 or 403 status, so the code is needed to tell them apart.
+func wapiError(body []byte) (string, error) {
+	e := struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	json.Unmarshal(body, &e)
+
+	switch e.Error.Code {
+	case 1002, 2006, 2008, 2009:
+		return e.Error.Message, ErrAuth
+	case 2007:
+		return e.Error.Message, ErrQuota
+	case 1006:
+		return e.Error.Message, ErrNotFound
+	}
+	return e.Error.Message, nil
+}
+
+func (a *wapiApi) getCurrent(ctx context.Context) (*wapiCurrent, error) {
 	url := fmt.Sprintf("%s?key=%s&q=%s&aqi=yes",
 		wapiApiBase,
-		a.key,
+		a.key.Value(),
 		url.QueryEscape(fmt.Sprintf("%v,%v", a.coord.Lat, a.coord.Lon)),
 	)
-
-	rsp, err := a.client.Get(url)
-	if err != nil {
-		return nil, err
+	// WeatherAPI translates the condition text itself, but English is the default and not one of its
+	// language codes
+	if a.lang != DefaultLanguage {
+		url += "&lang=" + a.lang
 	}
 
-	if rsp.StatusCode != 200 {
-		slog.Error("Invalid status code", "code", rsp.StatusCode, "status", rsp.Status)
-		return nil, errors.New("invalid response status code")
-	}
-
-	rspData, err := io.ReadAll(rsp.Body)
-	if err != nil {
-		return nil, err
-	}
 	ret := &wapiCurrent{}
-	err = json.Unmarshal(rspData, ret)
+	err := getJSON(ctx, a.client, wapiProvider, url, nil, ret, wapiError)
 	if err != nil {
 		return nil, err
 	}
 
 	return ret, nil
 }
+
+// wapiCondition maps a WeatherAPI condition code to a Condition
+func wapiCondition(code int) Condition {
+	switch code {
+	case 1000:
+		return ConditionClear
+	case 1003:
+		return ConditionPartlyCloudy
+	case 1006, 1009:
+		return ConditionCloudy
+	case 1030, 1135, 1147:
+		return ConditionFog
+	case 1150, 1153:
+		return ConditionDrizzle
+	case 1063, 1180, 1183, 1186, 1189, 1192, 1195, 1240, 1243, 1246:
+		return ConditionRain
+	case 1072, 1168, 1171, 1198, 1201:
+		return ConditionFreezingRain
+	case 1069, 1204, 1207, 1237, 1249, 1252, 1261, 1264:
+		return ConditionSleet
+	case 1066, 1114, 1117, 1210, 1213, 1216, 1219, 1222, 1225, 1255, 1258:
+		return ConditionSnow
+	case 1087, 1273, 1276, 1279, 1282:
+		return ConditionThunderstorm
+	}
+	return ConditionUnknown
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+)
+
+type Config struct {
+	TTL     time.Duration // How long a response is served from the cache, when the provider does not say
+	MinTTL  time.Duration // Lower bound on how long a response is served from the cache, whatever the provider says
+	MaxTTL  time.Duration // Upper bound on how long a response is served from the cache, whatever the provider says
+	Dir     string        // Directory to persist responses in, so they survive restarts. Empty keeps them in memory only.
+	MaxSize int64         // Maximum total size of the cached responses, in bytes. Zero is unlimited.
+
+	// Called for every GET request, with whether it was served from the cache without asking the
+	// RoundTripper it wraps
+	Observe func(req *http.Request, hit bool)
+}
+
+// entry is a single cached response
+type entry struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Expires    time.Time   `json:"expires"`
+}
+
+func (e *entry) fresh() bool {
+	return time.Now().Before(e.Expires)
+}
+
+// revalidatable reports whether the provider gave validators for the entry, so that once it is
+// stale the provider can be asked whether it has changed, rather than sending it again in full
+func (e *entry) revalidatable() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// size approximates the memory used by the entry, which is mostly its body
+func (e *entry) size() int64 {
+	size := int64(len(e.Body))
+	for name, values := range e.Header {
+		size += int64(len(name))
+		for _, v := range values {
+			size += int64(len(v))
+		}
+	}
+	return size
+}
+
+func (e *entry) toResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+type store interface {
+	get(key string) (*entry, bool)
+	put(key string, e *entry)
+}
+
+// Transport is an http.RoundTripper which caches successful GET responses from the RoundTripper
+// it wraps, shared between every request made through it.
+type Transport struct {
+	next    http.RoundTripper
+	ttl     time.Duration
+	minTTL  time.Duration
+	maxTTL  time.Duration
+	store   store
+	observe func(req *http.Request, hit bool)
+}
+
+func NewTransport(next http.RoundTripper, cfg Config) (*Transport, error) {
+	t := &Transport{
+		next:    next,
+		ttl:     cfg.TTL,
+		minTTL:  cfg.MinTTL,
+		maxTTL:  cfg.MaxTTL,
+		observe: cfg.Observe,
+	}
+	if t.observe == nil {
+		t.observe = func(*http.Request, bool) {}
+	}
+
+	if cfg.Dir == "" {
+		t.store = newMemoryStore(cfg.MaxSize)
+		return t, nil
+	}
+
+	s, err := newDiskStore(cfg.Dir, cfg.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	t.store = s
+	return t, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	cached, ok := t.store.get(key)
+	if ok && cached.fresh() {
+		t.observe(req, true)
+		return cached.toResponse(req), nil
+	}
+	t.observe(req, false)
+
+	// If we hold a stale copy that the provider gave us validators for, ask the provider whether it
+	// has changed rather than fetching it again in full.
+	if ok {
+		req = revalidate(req, cached)
+	}
+
+	rsp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return rsp, err
+	}
+	if ok && rsp.StatusCode == http.StatusNotModified {
+		rsp.Body.Close()
+		refreshed := &entry{
+			StatusCode: cached.StatusCode,
+			Header:     cached.Header.Clone(),
+			Body:       cached.Body,
+		}
+		for name, values := range rsp.Header {
+			refreshed.Header[name] = values
+		}
+		refreshed.Expires = time.Now().Add(t.lifetime(req, refreshed.Header))
+		t.store.put(key, refreshed)
+		return refreshed.toResponse(req), nil
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return rsp, nil
+	}
+
+	body, err := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	rsp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.store.put(key, &entry{
+		StatusCode: rsp.StatusCode,
+		Header:     rsp.Header.Clone(),
+		Body:       body,
+		Expires:    time.Now().Add(t.lifetime(req, rsp.Header)),
+	})
+	return rsp, nil
+}
+
+// revalidate makes a request conditional on the cached copy having changed
+func revalidate(req *http.Request, cached *entry) *http.Request {
+	if !cached.revalidatable() {
+		return req
+	}
+	etag := cached.Header.Get("ETag")
+	lastModified := cached.Header.Get("Last-Modified")
+
+	req = req.Clone(req.Context())
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	return req
+}
+
+// cacheKey identifies a request in the cache. Since request URLs may contain API keys, they are
+// hashed rather than stored as-is.
+func cacheKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.String()))
+	return hex.EncodeToString(sum[:])
+}
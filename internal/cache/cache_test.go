@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// upstream is a RoundTripper standing in for a provider, which sends an ETag with every response
+// and answers conditional requests with 304 Not Modified
+type upstream struct {
+	mu          sync.Mutex
+	requests    int
+	conditional int
+	header      http.Header
+}
+
+func (u *upstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests++
+
+	header := u.header.Clone()
+	header.Set("ETag", `"`+req.URL.Path+`"`)
+	status, body := http.StatusOK, "body of "+req.URL.Path
+	if req.Header.Get("If-None-Match") == header.Get("ETag") {
+		u.conditional++
+		status, body = http.StatusNotModified, ""
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func get(t *testing.T, transport http.RoundTripper, url string) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestTransportRevalidatesEveryStaleEntry(t *testing.T) {
+	// no-cache makes every response stale as soon as it is stored
+	u := &upstream{header: http.Header{"Cache-Control": {"no-cache"}}}
+	transport, err := NewTransport(u, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls := []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+	for _, url := range urls {
+		get(t, transport, url)
+	}
+	for _, url := range urls {
+		if body := get(t, transport, url); body != "body of "+strings.TrimPrefix(url, "https://example.com") {
+			t.Errorf("expected the cached body for %s, got %q", url, body)
+		}
+	}
+
+	if u.requests != 6 {
+		t.Errorf("expected 6 upstream requests, got %d", u.requests)
+	}
+	if u.conditional != 3 {
+		t.Errorf("expected all 3 stale entries to be revalidated, got %d", u.conditional)
+	}
+}
+
+func TestTransportServesFreshEntries(t *testing.T) {
+	u := &upstream{header: http.Header{"Cache-Control": {"max-age=60"}}}
+	transport, err := NewTransport(u, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get(t, transport, "https://example.com/a")
+	get(t, transport, "https://example.com/a")
+	if u.requests != 1 {
+		t.Errorf("expected 1 upstream request, got %d", u.requests)
+	}
+}
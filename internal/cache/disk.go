@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	diskSuffix = ".json"
+)
+
+// diskStore persists each response as a file in a directory, removing the least recently written
+// files once their total size exceeds the limit.
+type diskStore struct {
+	dir     string
+	maxSize int64
+
+	mu sync.Mutex
+}
+
+func newDiskStore(dir string, maxSize int64) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &diskStore{dir: dir, maxSize: maxSize}, nil
+}
+
+func (s *diskStore) path(key string) string {
+	return filepath.Join(s.dir, key+diskSuffix)
+}
+
+func (s *diskStore) get(key string) (*entry, bool) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	e := &entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		slog.Warn("Discarding unreadable cache entry", "path", s.path(key), "err", err)
+		os.Remove(s.path(key))
+		return nil, false
+	}
+	return e, true
+}
+
+func (s *diskStore) put(key string, e *entry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("Unable to encode cache entry", "err", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write to a temporary file first, so a crash never leaves a partial entry behind
+	tmp, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		slog.Error("Unable to write cache entry", "err", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(key))
+	}
+	if err != nil {
+		slog.Error("Unable to write cache entry", "err", err)
+		os.Remove(tmp.Name())
+		return
+	}
+
+	s.evict()
+}
+
+// evict removes the oldest entries until the cache fits within its size limit
+func (s *diskStore) evict() {
+	if s.maxSize <= 0 {
+		return
+	}
+
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		slog.Error("Unable to list cache directory", "dir", s.dir, "err", err)
+		return
+	}
+
+	files := make([]os.FileInfo, 0, len(dirEntries))
+	total := int64(0)
+	for _, de := range dirEntries {
+		if !strings.HasSuffix(de.Name(), diskSuffix) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, info := range files {
+		if total <= s.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(s.dir, info.Name())); err == nil {
+			total -= info.Size()
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl holds the directives of a Cache-Control header which affect a private client cache
+type cacheControl struct {
+	noCache bool
+	maxAge  time.Duration
+	hasAge  bool
+}
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			cc.noCache = true
+		case "max-age":
+			if secs, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				cc.maxAge = time.Duration(secs) * time.Second
+				cc.hasAge = true
+			}
+		}
+	}
+	return cc
+}
+
+type ttlKey struct{}
+
+// WithTTL sets how long the responses to requests made with the context are served from the cache,
+// overriding the upstream headers and the configured TTL and bounds.
+func WithTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, ttlKey{}, ttl)
+}
+
+// lifetime determines how long a response may be served from the cache. Unless the request set its
+// own TTL, this follows the upstream Cache-Control and Expires headers where present and falls back
+// to the configured TTL, clamping the result to the configured bounds either way.
+func (t *Transport) lifetime(req *http.Request, header http.Header) time.Duration {
+	if ttl, ok := req.Context().Value(ttlKey{}).(time.Duration); ok {
+		return ttl
+	}
+
+	cc := parseCacheControl(header)
+
+	lifetime := t.ttl
+	switch {
+	case cc.noCache:
+		lifetime = 0
+	case cc.hasAge:
+		lifetime = cc.maxAge - age(header)
+	case header.Get("Expires") != "":
+		// An invalid Expires header (commonly "0" or "-1") means the response is already stale
+		expires, err := http.ParseTime(header.Get("Expires"))
+		if err != nil {
+			lifetime = 0
+			break
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+		lifetime = expires.Sub(date)
+	}
+
+	if lifetime < t.minTTL {
+		lifetime = t.minTTL
+	}
+	if t.maxTTL > 0 && lifetime > t.maxTTL {
+		lifetime = t.maxTTL
+	}
+	return lifetime
+}
+
+// age returns how long a response had already spent in upstream caches when it was received
+func age(header http.Header) time.Duration {
+	secs, err := strconv.Atoi(header.Get("Age"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
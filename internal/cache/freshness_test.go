@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLifetime(t *testing.T) {
+	date := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	transport := &Transport{ttl: 10 * time.Minute, minTTL: time.Minute, maxTTL: time.Hour}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"no headers uses the TTL", http.Header{}, 10 * time.Minute},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=300"}}, 5 * time.Minute},
+		{"quoted max-age", http.Header{"Cache-Control": {`max-age="300"`}}, 5 * time.Minute},
+		{"max-age less Age", http.Header{"Cache-Control": {"max-age=900"}, "Age": {"300"}}, 10 * time.Minute},
+		{"invalid Age is ignored", http.Header{"Cache-Control": {"max-age=300"}, "Age": {"soon"}}, 5 * time.Minute},
+		{"max-age takes precedence over Expires", http.Header{
+			"Cache-Control": {"max-age=300"},
+			"Date":          {date.Format(http.TimeFormat)},
+			"Expires":       {date.Add(30 * time.Minute).Format(http.TimeFormat)},
+		}, 5 * time.Minute},
+		{"Expires relative to Date", http.Header{
+			"Date":    {date.Format(http.TimeFormat)},
+			"Expires": {date.Add(30 * time.Minute).Format(http.TimeFormat)},
+		}, 30 * time.Minute},
+		{"invalid Expires is stale", http.Header{"Expires": {"0"}}, time.Minute},
+		{"no-cache is stale", http.Header{"Cache-Control": {"no-cache"}}, time.Minute},
+		{"clamped to the maximum", http.Header{"Cache-Control": {"max-age=86400"}}, time.Hour},
+		{"clamped to the minimum", http.Header{"Cache-Control": {"max-age=5"}}, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+			if got := transport.lifetime(req, tt.header); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLifetimeWithTTL(t *testing.T) {
+	transport := &Transport{ttl: 10 * time.Minute, minTTL: time.Minute, maxTTL: time.Hour}
+	req, _ := http.NewRequestWithContext(WithTTL(context.Background(), 2*time.Hour), http.MethodGet, "https://example.com", nil)
+
+	// A TTL set for the request overrides the headers and the bounds
+	if got := transport.lifetime(req, http.Header{"Cache-Control": {"no-cache"}}); got != 2*time.Hour {
+		t.Errorf("expected 2h, got %v", got)
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// How long a stale entry with validators is kept for, in case its URL is requested again. Entries
+// without validators are no use once stale, so are dropped straight away.
+const staleRetention = 24 * time.Hour
+
+// memoryStore keeps responses in memory, removing the least recently stored once their total size
+// exceeds the limit.
+type memoryStore struct {
+	maxSize int64
+
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	size    int64
+}
+
+type memoryEntry struct {
+	*entry
+	stored time.Time
+	size   int64
+}
+
+func newMemoryStore(maxSize int64) *memoryStore {
+	return &memoryStore{maxSize: maxSize, entries: make(map[string]*memoryEntry)}
+}
+
+func (s *memoryStore) get(key string) (*entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return e.entry, true
+}
+
+func (s *memoryStore) put(key string, e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop anything that has expired and cannot be revalidated, so that URLs which are no longer
+	// requested do not build up. Locations tend to expire together, so those which can be
+	// revalidated are kept until they are requested again.
+	for k, old := range s.entries {
+		if !old.fresh() && (!old.revalidatable() || time.Since(old.Expires) > staleRetention) {
+			s.remove(k)
+		}
+	}
+	s.remove(key)
+	s.entries[key] = &memoryEntry{entry: e, stored: time.Now(), size: e.size()}
+	s.size += s.entries[key].size
+
+	s.evict()
+}
+
+func (s *memoryStore) remove(key string) {
+	if old, ok := s.entries[key]; ok {
+		s.size -= old.size
+		delete(s.entries, key)
+	}
+}
+
+// evict removes the oldest entries until the cache fits within its size limit
+func (s *memoryStore) evict() {
+	if s.maxSize <= 0 {
+		return
+	}
+	for s.size > s.maxSize {
+		oldest := ""
+		for k, e := range s.entries {
+			if oldest == "" || e.stored.Before(s.entries[oldest].stored) {
+				oldest = k
+			}
+		}
+		s.remove(oldest)
+	}
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreEvictsOldestOverMaxSize(t *testing.T) {
+	s := newMemoryStore(250)
+	for _, key := range []string{"a", "b", "c"} {
+		s.put(key, &entry{Body: make([]byte, 100), Expires: time.Now().Add(time.Hour)})
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, ok := s.get("a"); ok {
+		t.Error("expected the oldest entry to be evicted")
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, ok := s.get(key); !ok {
+			t.Errorf("expected entry %q to be kept", key)
+		}
+	}
+	if s.size != 200 {
+		t.Errorf("expected a size of 200, got %d", s.size)
+	}
+}
+
+func TestMemoryStoreReplacesEntry(t *testing.T) {
+	s := newMemoryStore(0)
+	s.put("a", &entry{Body: make([]byte, 100), Expires: time.Now().Add(time.Hour)})
+	s.put("a", &entry{Body: make([]byte, 50), Expires: time.Now().Add(time.Hour)})
+
+	if s.size != 50 {
+		t.Errorf("expected a size of 50, got %d", s.size)
+	}
+}
@@ -1,7 +1,10 @@
 package exporter
 
 import (
+	"context"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gca3020/weather_exporter/internal/api"
 	"github.com/prometheus/client_golang/prometheus"
@@ -9,62 +12,71 @@ import (
 
 var Namespace = "weather"
 
+// Help text for the gauge of each measurement. Measurements which can be converted to other units
+// take the description of the unit as an argument.
+var fieldHelp = map[string]string{
+	"temperature":      "The temperature at ground level, in %s",
+	"feelslike":        "The apparent (feels like) temperature at ground level, in %s",
+	"humidity":         "The current relative humidity percentage",
+	"pressure_msl":     "The mean atmospheric pressure at sea level (MSL), in %s",
+	"pressure_surface": "The atmospheric pressure at the ground/surface level, in %s",
+	"visibility":       "The visibility, in %s",
+	"wind_speed":       "The wind speed, in %s",
+	"wind_dir":         "The wind direction, in degrees",
+	"wind_gust":        "The maximum wind gust speed, in %s",
+	"cloud_pct":        "The cloud cover percentage",
+	"rain":             "The current hourly rainfall rate, in %s",
+	"snow":             "The current hourly snowfall rate, in %s",
+	"uv_index":         "The ultraviolet index",
+	"aq_index":         "The air quality index",
+	"co_conc":          "The carbon monoxide (CO) concentration, in μg/m^3",
+	"no_conc":          "The nitrogen monoxide (NO) concentration, in μg/m^3",
+	"no2_conc":         "The nitrogen dioxide (NO2) concentration, in μg/m^3",
+	"o3_conc":          "The ozone (O3) concentration, in μg/m^3",
+	"so2_conc":         "The sulfur dioxide (SO2) concentration, in μg/m^3",
+	"nh3_conc":         "The ammonia (NH3) concentration, in μg/m^3",
+	"pm2p5_conc":       "The fine particulate (<2.5μm) concentration, in μg/m^3",
+	"pm10_conc":        "The coarse particulate (<10μm) concentration, in μg/m^3",
+}
+
 type Collector struct {
-	apis []api.WeatherApi
-
-	description *prometheus.Desc
-	temperature *prometheus.Desc
-	feelsLike   *prometheus.Desc
-	humidity    *prometheus.Desc
-	pressureGnd *prometheus.Desc
-	pressureSea *prometheus.Desc
-	visibility  *prometheus.Desc
-	windSpeed   *prometheus.Desc
-	windDir     *prometheus.Desc
-	windGust    *prometheus.Desc
-	clouds      *prometheus.Desc
-	rain        *prometheus.Desc
-	snow        *prometheus.Desc
-	uvi         *prometheus.Desc
-	aqi         *prometheus.Desc
-	co          *prometheus.Desc
-	no          *prometheus.Desc
-	no2         *prometheus.Desc
-	o3          *prometheus.Desc
-	so2         *prometheus.Desc
-	nh3         *prometheus.Desc
-	pm2p5       *prometheus.Desc
-	pm10        *prometheus.Desc
+	mu        sync.RWMutex
+	targets   []*target
+	units     api.Units
+	consensus *consensus
+	ready     atomic.Bool // Set once every target has been polled
+
+	description   *prometheus.Desc // Only reported in the v1 schema
+	conditionInfo *prometheus.Desc // Only reported in the v2 schema
+	condition     *prometheus.Desc
+	conditionCode *prometheus.Desc
+	upstream      *prometheus.Desc
+	gauges        []gauge
 }
 
-func NewCollector(apis []api.WeatherApi) *Collector {
-	return &Collector{
-		apis: apis,
-
-		description: prometheus.NewDesc(fqName("description"), "Human-readable description of the current conditions", []string{"provider", "location", "coordinates", "desc"}, nil),
-		temperature: prometheus.NewDesc(fqName("temperature"), "The temperature at ground level, in Celsius", []string{"provider", "location", "coordinates"}, nil),
-		feelsLike:   prometheus.NewDesc(fqName("feelslike"), "The apparent (feels like) temperature at ground level", []string{"provider", "location", "coordinates"}, nil),
-		humidity:    prometheus.NewDesc(fqName("humidity"), "The current relative humidity percentage", []string{"provider", "location", "coordinates"}, nil),
-		pressureSea: prometheus.NewDesc(fqName("pressure_msl"), "The mean atmospheric pressure at sea level (MSL), in hPa", []string{"provider", "location", "coordinates"}, nil),
-		pressureGnd: prometheus.NewDesc(fqName("pressure_surface"), "The atmospheric pressure at the ground/surface level, in hPa", []string{"provider", "location", "coordinates"}, nil),
-		visibility:  prometheus.NewDesc(fqName("visibility"), "The visibility, in meters", []string{"provider", "location", "coordinates"}, nil),
-		windSpeed:   prometheus.NewDesc(fqName("wind_speed"), "The wind speed, in meters/second", []string{"provider", "location", "coordinates"}, nil),
-		windDir:     prometheus.NewDesc(fqName("wind_dir"), "The wind direction, in degrees", []string{"provider", "location", "coordinates"}, nil),
-		windGust:    prometheus.NewDesc(fqName("wind_gust"), "The maximum wind gust speed, in meters/second", []string{"provider", "location", "coordinates"}, nil),
-		clouds:      prometheus.NewDesc(fqName("cloud_pct"), "The cloud cover percentage", []string{"provider", "location", "coordinates"}, nil),
-		rain:        prometheus.NewDesc(fqName("rain"), "The current hourly rainfall rate, in mm", []string{"provider", "location", "coordinates"}, nil),
-		snow:        prometheus.NewDesc(fqName("snow"), "The current hourly snowfall rate, in mm", []string{"provider", "location", "coordinates"}, nil),
-		uvi:         prometheus.NewDesc(fqName("uv_index"), "The ultraviolet index", []string{"provider", "location", "coordinates"}, nil),
-		aqi:         prometheus.NewDesc(fqName("aq_index"), "The air quality index", []string{"provider", "location", "coordinates"}, nil),
-		co:          prometheus.NewDesc(fqName("co_conc"), "The carbon monoxide (CO) concentration, in μg/m^3", []string{"provider", "location", "coordinates"}, nil),
-		no:          prometheus.NewDesc(fqName("no_conc"), "The nitrogen monoxide (NO) concentration, in μg/m^3", []string{"provider", "location", "coordinates"}, nil),
-		no2:         prometheus.NewDesc(fqName("no2_conc"), "The nitrogen dioxide (NO2) concentration, in μg/m^3", []string{"provider", "location", "coordinates"}, nil),
-		o3:          prometheus.NewDesc(fqName("o3_conc"), "The ozone (O3) concentration, in μg/m^3", []string{"provider", "location", "coordinates"}, nil),
-		so2:         prometheus.NewDesc(fqName("so2_conc"), "The sulfur dioxide (SO2) concentration, in μg/m^3", []string{"provider", "location", "coordinates"}, nil),
-		nh3:         prometheus.NewDesc(fqName("nh3_conc"), "The ammonia (NH3) concentration, in μg/m^3", []string{"provider", "location", "coordinates"}, nil),
-		pm2p5:       prometheus.NewDesc(fqName("pm2p5_conc"), "The fine particulate (<2.5μm) concentration, in μg/m^3", []string{"provider", "location", "coordinates"}, nil),
-		pm10:        prometheus.NewDesc(fqName("pm10_conc"), "The coarse particulate (<10μm) concentration, in μg/m^3", []string{"provider", "location", "coordinates"}, nil),
+// NewCollector returns a collector for the given APIs, which reports each measurement in the given
+// units, under the names of the given schema. Measurements reported in anything other than the
+// unit they are normalized to have the unit added to their metric name, whatever the schema (e.g.
+// weather_temperature_fahrenheit).
+func NewCollector(apis []api.WeatherApi, units api.Units, schema Schema) *Collector {
+	c := &Collector{
+		targets: newTargets(apis),
+		units:   units,
+		gauges:  newGauges(schema, units),
+
+		// The condition is a StateSet, so the state label is named after the metric, as OpenMetrics expects
+		condition:     prometheus.NewDesc(fqName("condition"), "The kind of weather, normalized between providers, with 1 for the current condition and 0 for the others", []string{"provider", "location", "coordinates", fqName("condition")}, nil),
+		conditionCode: prometheus.NewDesc(fqName("condition_code"), "The numeric code of the kind of weather, normalized between providers", []string{"provider", "location", "coordinates"}, nil),
+		upstream:      prometheus.NewDesc(fqName("failover_upstream"), "The provider currently supplying the conditions for a failover chain", []string{"provider", "location", "coordinates", "upstream"}, nil),
+	}
+	if schema&SchemaV1 != 0 {
+		c.description = prometheus.NewDesc(fqName("description"), "Human-readable description of the current conditions", []string{"provider", "location", "coordinates", "desc"}, nil)
 	}
+	if schema&SchemaV2 != 0 {
+		c.conditionInfo = prometheus.NewDesc(fqName("condition_info"), "The current conditions, with a human-readable description", []string{"provider", "location", "coordinates", "description"}, nil)
+	}
+	c.consensus = newConsensus(c.gauges)
+	return c
 }
 
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
@@ -72,38 +84,129 @@ func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
-	for _, api := range c.apis {
-		cc, err := api.GetCurrentConditions()
-		slog.Debug("metrics collected", "conditions", cc, "err", err)
+	c.collect(context.Background(), ch)
+}
 
-		if err != nil {
-			return
+// Bind returns a collector which queries the providers using the given context, so that any
+// requests still in flight are abandoned when the context is cancelled (such as when the scrape
+// which triggered them times out).
+func (c *Collector) Bind(ctx context.Context) prometheus.Collector {
+	return &boundCollector{c: c, ctx: ctx}
+}
+
+// SetApis replaces the APIs the collector queries, taking effect from the next scrape. Scrapes
+// already in progress finish with the APIs they started with.
+func (c *Collector) SetApis(apis []api.WeatherApi) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets = newTargets(apis)
+}
+
+// Prime polls every target once, so that the collector becomes ready, and the conditions are
+// available to the other handlers, without waiting for the first scrape.
+func (c *Collector) Prime(ctx context.Context) {
+	c.poll(ctx)
+}
+
+// Ready reports whether every target has been polled at least once, successfully or not
+func (c *Collector) Ready() bool {
+	return c.ready.Load()
+}
+
+// Targets returns the state of every target as of its most recent poll, in the order the providers
+// were configured.
+func (c *Collector) Targets() []TargetState {
+	c.mu.RLock()
+	targets := c.targets
+	c.mu.RUnlock()
+
+	states := make([]TargetState, 0, len(targets))
+	for _, t := range targets {
+		states = append(states, t.state())
+	}
+	return states
+}
+
+// poll queries every provider concurrently, returning the conditions from those which succeeded in
+// the order the providers were configured.
+func (c *Collector) poll(ctx context.Context) []*api.CurrentConditions {
+	c.mu.RLock()
+	targets := c.targets
+	c.mu.RUnlock()
+
+	all := make([]*api.CurrentConditions, len(targets))
+
+	wg := sync.WaitGroup{}
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t *target) {
+			defer wg.Done()
+			cc, err := t.api.GetCurrentConditions(ctx)
+			t.update(cc, err)
+			if err != nil {
+				slog.Error("Unable to get current conditions", "kind", api.ErrorKind(err), "err", err)
+				return
+			}
+			slog.Debug("metrics collected", "conditions", cc)
+			all[i] = cc
+		}(i, t)
+	}
+	wg.Wait()
+	c.ready.Store(true)
+
+	results := make([]*api.CurrentConditions, 0, len(all))
+	for _, cc := range all {
+		if cc != nil {
+			results = append(results, cc)
 		}
+	}
+	return results
+}
+
+func (c *Collector) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	results := c.poll(ctx)
+	for i, cc := range results {
+		results[i] = c.units.Convert(cc)
+	}
 
-		ch <- prometheus.MustNewConstMetric(c.description, prometheus.GaugeValue, 1, cc.Provider, cc.LocationName, cc.Coordinates, cc.Description)
-		ch <- prometheus.MustNewConstMetric(c.temperature, prometheus.GaugeValue, cc.Temp, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.feelsLike, prometheus.GaugeValue, cc.FeelsLike, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.humidity, prometheus.GaugeValue, cc.Humidity, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.pressureSea, prometheus.GaugeValue, cc.PressureSea, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.pressureGnd, prometheus.GaugeValue, cc.PressureGnd, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.visibility, prometheus.GaugeValue, cc.Visibility, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.windSpeed, prometheus.GaugeValue, cc.WindSpeed, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.windDir, prometheus.GaugeValue, cc.WindDirection, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.windGust, prometheus.GaugeValue, cc.WindGust, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.clouds, prometheus.GaugeValue, cc.Clouds, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.rain, prometheus.GaugeValue, cc.Rain, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.snow, prometheus.GaugeValue, cc.Snow, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.uvi, prometheus.GaugeValue, cc.UvIndex, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.aqi, prometheus.GaugeValue, cc.AqIndex, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.co, prometheus.GaugeValue, cc.CO, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.no, prometheus.GaugeValue, cc.NO, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.no2, prometheus.GaugeValue, cc.NO2, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.o3, prometheus.GaugeValue, cc.O3, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.so2, prometheus.GaugeValue, cc.SO2, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.nh3, prometheus.GaugeValue, cc.NH3, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.pm2p5, prometheus.GaugeValue, cc.Pm2p5, cc.Provider, cc.LocationName, cc.Coordinates)
-		ch <- prometheus.MustNewConstMetric(c.pm10, prometheus.GaugeValue, cc.Pm10, cc.Provider, cc.LocationName, cc.Coordinates)
+	for _, cc := range results {
+		if c.description != nil {
+			ch <- prometheus.MustNewConstMetric(c.description, prometheus.GaugeValue, 1, cc.Provider, cc.LocationName, cc.Coordinates, cc.Description)
+		}
+		if c.conditionInfo != nil {
+			ch <- prometheus.MustNewConstMetric(c.conditionInfo, prometheus.GaugeValue, 1, cc.Provider, cc.LocationName, cc.Coordinates, cc.Description)
+		}
+		for _, cond := range api.Conditions {
+			state := 0.0
+			if cond == cc.Condition {
+				state = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.condition, prometheus.GaugeValue, state, cc.Provider, cc.LocationName, cc.Coordinates, cond.String())
+		}
+		ch <- prometheus.MustNewConstMetric(c.conditionCode, prometheus.GaugeValue, float64(cc.Condition), cc.Provider, cc.LocationName, cc.Coordinates)
+		if cc.Upstream != "" {
+			ch <- prometheus.MustNewConstMetric(c.upstream, prometheus.GaugeValue, 1, cc.Provider, cc.LocationName, cc.Coordinates, cc.Upstream)
+		}
+		for _, g := range c.gauges {
+			emitGauge(ch, g, cc)
+		}
+	}
+
+	c.consensus.collect(ch, results)
+}
+
+// emitGauge sends a single gauge for a set of conditions. Values the provider does not report have
+// always been exported as zero in the v1 schema, so they still are, but are left out of v2. Readings
+// rejected as implausible are left out of both.
+func emitGauge(ch chan<- prometheus.Metric, g gauge, cc *api.CurrentConditions) {
+	value := g.value(cc)
+	if api.IsMissing(value) {
+		if !g.zero || cc.Rejected[g.field.Name] {
+			return
+		}
+		value = 0
 	}
+	ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, value, cc.Provider, cc.LocationName, cc.Coordinates)
 }
 
 func fqName(name string) string {
@@ -0,0 +1,64 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gaugeValues returns the value exported by each gauge for a set of conditions, leaving out those
+// which were not exported at all
+func gaugeValues(t *testing.T, gauges []gauge, cc *api.CurrentConditions) map[string]float64 {
+	t.Helper()
+	values := make(map[string]float64)
+	for _, g := range gauges {
+		ch := make(chan prometheus.Metric, 1)
+		emitGauge(ch, g, cc)
+		close(ch)
+		for m := range ch {
+			var out dto.Metric
+			if err := m.Write(&out); err != nil {
+				t.Fatal(err)
+			}
+			values[g.name] = out.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+func missingConditions() *api.CurrentConditions {
+	cc := &api.CurrentConditions{Provider: "Stub", Coordinates: "0,0"}
+	for _, f := range api.Fields {
+		*f.Value(cc) = api.Missing
+	}
+	return cc
+}
+
+func TestEmitGauge(t *testing.T) {
+	cc := missingConditions()
+	cc.Temp = 12.5
+	cc.PressureSea = api.Missing
+	cc.Rejected = map[string]bool{"pressure_msl": true}
+
+	values := gaugeValues(t, newGauges(SchemaBoth, api.GetUnits()), cc)
+	tests := []struct {
+		name     string
+		exported bool
+		want     float64
+	}{
+		{"temperature", true, 12.5},
+		{"temperature_celsius", true, 12.5},
+		{"humidity", true, 0}, // Not reported by the provider, which v1 has always exported as zero
+		{"relative_humidity_ratio", false, 0},
+		{"pressure_msl", false, 0},
+		{"pressure_msl_hpa", false, 0},
+	}
+	for _, tt := range tests {
+		got, ok := values[tt.name]
+		if ok != tt.exported || got != tt.want {
+			t.Errorf("%s: expected exported=%v value=%v, got exported=%v value=%v", tt.name, tt.exported, tt.want, ok, got)
+		}
+	}
+}
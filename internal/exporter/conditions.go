@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+	"github.com/gca3020/weather_exporter/internal/redact"
+)
+
+// conditionsResponse is the body served by the conditions handler
+type conditionsResponse struct {
+	Targets []targetJSON `json:"targets"`
+}
+
+type targetJSON struct {
+	Provider    string             `json:"provider"`
+	Location    string             `json:"location"`
+	Coordinates string             `json:"coordinates"`
+	Upstream    string             `json:"upstream,omitempty"`
+	Labels      map[string]string  `json:"labels"`
+	LastPoll    *time.Time         `json:"last_poll,omitempty"`
+	ObservedAt  *time.Time         `json:"observed_at,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	ErrorKind   string             `json:"error_kind,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Condition   string             `json:"condition,omitempty"`
+	Present     []string           `json:"present"`
+	Fields      map[string]float64 `json:"fields"`
+}
+
+// NewConditionsHandler returns an http.Handler which serves the latest conditions for every
+// target as JSON. This does not poll the providers itself, so it reflects the most recent scrape.
+func NewConditionsHandler(c *Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := WriteConditions(w, c.Targets()); err != nil {
+			slog.Error("Unable to write conditions", "err", err)
+		}
+	})
+}
+
+// WriteConditions writes the conditions of the given targets as JSON, in the same format as the
+// conditions handler serves
+func WriteConditions(w io.Writer, states []TargetState) error {
+	resp := conditionsResponse{Targets: make([]targetJSON, 0, len(states))}
+	for _, state := range states {
+		resp.Targets = append(resp.Targets, newTargetJSON(state))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(resp)
+}
+
+func newTargetJSON(state TargetState) targetJSON {
+	t := targetJSON{
+		Provider:    state.Target.Provider,
+		Coordinates: state.Target.Coordinates,
+		LastPoll:    timeOrNil(state.LastPoll),
+		Present:     make([]string, 0),
+		Fields:      make(map[string]float64),
+	}
+	if state.Err != nil {
+		t.Error = redact.String(state.Err.Error())
+		t.ErrorKind = api.ErrorKind(state.Err)
+	}
+
+	// Measurements the provider does not report are left out, since JSON has no NaN
+	if cc := state.Conditions; cc != nil {
+		t.Location = cc.LocationName
+		t.Upstream = cc.Upstream
+		t.ObservedAt = timeOrNil(cc.ObservedAt)
+		t.Description = cc.Description
+		t.Condition = cc.Condition.String()
+		for _, f := range api.Fields {
+			if v := *f.Value(cc); !api.IsMissing(v) {
+				t.Present = append(t.Present, f.Name)
+				t.Fields[f.Name] = v
+			}
+		}
+	}
+	t.Labels = map[string]string{"provider": t.Provider, "location": t.Location, "coordinates": t.Coordinates}
+	return t
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,136 @@
+package exporter
+
+import (
+	"math"
+	"sort"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// consensus combines the readings of every provider configured for the same coordinates into a
+// single set of statistics per measurement, along with the spread between the providers.
+type consensus struct {
+	providers *prometheus.Desc
+	gauges    []gauge
+	stats     []*prometheus.Desc // The consensus metric for each gauge
+}
+
+// newConsensus creates a consensus metric for each of the collector's gauges
+func newConsensus(gauges []gauge) *consensus {
+	c := &consensus{
+		providers: prometheus.NewDesc(fqName("consensus_providers"), "The number of providers contributing to the consensus for a location", []string{"location", "coordinates"}, nil),
+		gauges:    gauges,
+		stats:     make([]*prometheus.Desc, 0, len(gauges)),
+	}
+	for _, g := range gauges {
+		c.stats = append(c.stats, prometheus.NewDesc(
+			fqName("consensus_"+g.name),
+			"The median, mean, min, max and spread of "+fqName(g.name)+" across all providers for a location",
+			[]string{"location", "coordinates", "stat"}, nil,
+		))
+	}
+	return c
+}
+
+func (c *consensus) collect(ch chan<- prometheus.Metric, results []*api.CurrentConditions) {
+	// Group the results by coordinates, preserving the order in which they were configured
+	groups := make(map[string][]*api.CurrentConditions)
+	order := make([]string, 0)
+	for _, cc := range results {
+		// Failover chains repeat the readings of one of the other providers, so would be counted twice
+		if cc.Upstream != "" {
+			continue
+		}
+		if _, ok := groups[cc.Coordinates]; !ok {
+			order = append(order, cc.Coordinates)
+		}
+		groups[cc.Coordinates] = append(groups[cc.Coordinates], cc)
+	}
+
+	for _, coords := range order {
+		group := groups[coords]
+		if len(group) < 2 {
+			continue
+		}
+
+		location := ""
+		for _, cc := range group {
+			if cc.LocationName != "" {
+				location = cc.LocationName
+				break
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(c.providers, prometheus.GaugeValue, float64(len(group)), location, coords)
+
+		for i, g := range c.gauges {
+			values := make([]float64, 0, len(group))
+			for _, cc := range group {
+				if v := g.value(cc); !api.IsMissing(v) {
+					values = append(values, v)
+				}
+			}
+			if len(values) == 0 {
+				continue
+			}
+
+			var stats map[string]float64
+			if g.field.Circular {
+				stats = circularStats(values)
+			} else {
+				stats = linearStats(values)
+			}
+			for stat, v := range stats {
+				ch <- prometheus.MustNewConstMetric(c.stats[i], prometheus.GaugeValue, v, location, coords, stat)
+			}
+		}
+	}
+}
+
+func linearStats(values []float64) map[string]float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+
+	n := len(sorted)
+	median := sorted[n/2]
+	if n%2 == 0 {
+		median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+
+	return map[string]float64{
+		"median": median,
+		"mean":   sum / float64(n),
+		"min":    sorted[0],
+		"max":    sorted[n-1],
+		"spread": sorted[n-1] - sorted[0],
+	}
+}
+
+// circularStats handles measurements in degrees (e.g. wind direction), where 350 and 10 are close
+// together. Only the mean and spread are meaningful here, so the order statistics are omitted.
+func circularStats(values []float64) map[string]float64 {
+	sin, cos := 0.0, 0.0
+	for _, v := range values {
+		sin += math.Sin(v * math.Pi / 180)
+		cos += math.Cos(v * math.Pi / 180)
+	}
+	mean := math.Mod(math.Atan2(sin, cos)*180/math.Pi+360, 360)
+
+	spread := 0.0
+	for i := range values {
+		for j := i + 1; j < len(values); j++ {
+			diff := math.Abs(math.Mod(values[i]-values[j], 360))
+			spread = math.Max(spread, math.Min(diff, 360-diff))
+		}
+	}
+
+	return map[string]float64{
+		"mean":   mean,
+		"spread": spread,
+	}
+}
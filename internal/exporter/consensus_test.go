@@ -0,0 +1,151 @@
+package exporter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLinearStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   map[string]float64
+	}{
+		{"single value", []float64{5}, map[string]float64{"median": 5, "mean": 5, "min": 5, "max": 5, "spread": 0}},
+		{"odd count", []float64{30, 10, 20}, map[string]float64{"median": 20, "mean": 20, "min": 10, "max": 30, "spread": 20}},
+		{"even count", []float64{4, 1, 10, 3}, map[string]float64{"median": 3.5, "mean": 4.5, "min": 1, "max": 10, "spread": 9}},
+		{"negative values", []float64{-5, -15}, map[string]float64{"median": -10, "mean": -10, "min": -15, "max": -5, "spread": 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertStats(t, linearStats(tt.values), tt.want)
+		})
+	}
+}
+
+func TestCircularStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   map[string]float64
+	}{
+		{"same direction", []float64{90, 90}, map[string]float64{"mean": 90, "spread": 0}},
+		{"either side of north", []float64{350, 10}, map[string]float64{"mean": 0, "spread": 20}},
+		{"mean just west of north", []float64{340, 0}, map[string]float64{"mean": 350, "spread": 20}},
+		{"widest pair", []float64{80, 100, 200}, map[string]float64{"mean": 120, "spread": 120}},
+		{"opposite directions", []float64{0, 180}, map[string]float64{"spread": 180}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := circularStats(tt.values)
+			if _, ok := stats["median"]; ok {
+				t.Error("expected no median for a circular measurement")
+			}
+			if _, ok := tt.want["mean"]; !ok {
+				delete(stats, "mean") // Undefined when the directions cancel out
+			}
+			assertStats(t, stats, tt.want)
+		})
+	}
+}
+
+func assertStats(t *testing.T, got, want map[string]float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	for stat, v := range want {
+		if math.Abs(got[stat]-v) > 0.05 {
+			t.Errorf("%s: expected %v, got %v", stat, v, got[stat])
+		}
+	}
+}
+
+// consensusValues collects the consensus metrics for a set of results, as "name/stat" and the
+// number of providers, as "providers"
+func consensusValues(t *testing.T, c *consensus, results []*api.CurrentConditions) map[string]float64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 1000)
+	c.collect(ch, results)
+	close(ch)
+
+	values := make(map[string]float64)
+	for m := range ch {
+		var out dto.Metric
+		if err := m.Write(&out); err != nil {
+			t.Fatal(err)
+		}
+		key := "providers"
+		for i, stats := range c.stats {
+			if m.Desc() == stats {
+				key = c.gauges[i].name
+			}
+		}
+		for _, l := range out.GetLabel() {
+			if l.GetName() == "stat" {
+				key += "/" + l.GetValue()
+			}
+		}
+		values[key] = out.GetGauge().GetValue()
+	}
+	return values
+}
+
+func reading(provider string, temp float64) *api.CurrentConditions {
+	cc := missingConditions()
+	cc.Provider, cc.Coordinates, cc.Temp = provider, "40.7,-74", temp
+	return cc
+}
+
+func TestConsensus(t *testing.T) {
+	c := newConsensus(newGauges(SchemaV1, nil))
+
+	failover := reading("auto", 30)
+	failover.Upstream = "OpenMeteo"
+	other := reading("OpenMeteo", 40)
+	other.Coordinates = "51.5,-0.1"
+
+	tests := []struct {
+		name    string
+		results []*api.CurrentConditions
+		want    map[string]float64
+	}{
+		{"a single provider has no consensus", []*api.CurrentConditions{reading("OpenMeteo", 10)}, map[string]float64{}},
+		{"two providers", []*api.CurrentConditions{reading("OpenMeteo", 10), reading("OpenWeatherMap", 14)}, map[string]float64{
+			"providers": 2, "temperature/median": 12, "temperature/mean": 12, "temperature/min": 10, "temperature/max": 14, "temperature/spread": 4,
+		}},
+		{"failover chains are not counted twice", []*api.CurrentConditions{reading("OpenMeteo", 10), failover}, map[string]float64{}},
+		{"other coordinates are separate", []*api.CurrentConditions{reading("OpenMeteo", 10), other}, map[string]float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := consensusValues(t, c, tt.results)
+			if len(got) != len(tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+			for key, v := range tt.want {
+				if got[key] != v {
+					t.Errorf("%s: expected %v, got %v", key, v, got[key])
+				}
+			}
+		})
+	}
+}
+
+func TestConsensusSkipsMissingValues(t *testing.T) {
+	c := newConsensus(newGauges(SchemaV1, nil))
+	first, second := reading("OpenMeteo", 10), reading("TomorrowIO", 14)
+	first.AqIndex = 42
+
+	got := consensusValues(t, c, []*api.CurrentConditions{first, second})
+	if got["aq_index/mean"] != 42 || got["aq_index/min"] != 42 {
+		t.Errorf("expected only the reported air quality to contribute, got mean=%v min=%v", got["aq_index/mean"], got["aq_index/min"])
+	}
+	if _, ok := got["humidity/mean"]; ok {
+		t.Error("expected no consensus for a measurement no provider reports")
+	}
+}
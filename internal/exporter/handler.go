@@ -0,0 +1,51 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// Time left for encoding and sending the response before Prometheus gives up on a scrape
+	scrapeTimeoutOffset = 500 * time.Millisecond
+)
+
+// boundCollector collects from a Collector using a particular context
+type boundCollector struct {
+	c   *Collector
+	ctx context.Context
+}
+
+// Describe sends no descriptors, making this an unchecked collector. Otherwise registering it would
+// require querying every provider just to find out which metrics it reports.
+func (b *boundCollector) Describe(chan<- *prometheus.Desc) {
+}
+
+func (b *boundCollector) Collect(ch chan<- prometheus.Metric) {
+	b.c.collect(b.ctx, ch)
+}
+
+// NewHandler returns an http.Handler which serves the metrics from the gatherer along with those
+// from the collector. The collector is bound to each scrape's request, so a cancelled scrape
+// cancels the provider requests it triggered, and the scrape timeout sent by Prometheus is used as
+// a deadline for them.
+func NewHandler(c *Collector, gatherer prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if secs, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64); err == nil && secs > 0 {
+			var cancel context.CancelFunc
+			timeout := time.Duration(secs*float64(time.Second)) - scrapeTimeoutOffset
+			ctx, cancel = context.WithTimeout(ctx, max(timeout, scrapeTimeoutOffset))
+			defer cancel()
+		}
+
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(c.Bind(ctx))
+		promhttp.HandlerFor(prometheus.Gatherers{gatherer, reg}, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,26 @@
+package exporter
+
+import (
+	"io"
+	"net/http"
+)
+
+// NewHealthyHandler returns an http.Handler which reports that the exporter is running
+func NewHealthyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "Healthy\n")
+	})
+}
+
+// NewReadyHandler returns an http.Handler which reports whether the collector is ready, returning
+// a 503 until every target has been polled once, so that an orchestrator holds off sending scrapes
+// to a new instance until it has conditions to report.
+func NewReadyHandler(c *Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.Ready() {
+			http.Error(w, "Not ready", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "Ready\n")
+	})
+}
@@ -0,0 +1,189 @@
+package exporter
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+	"github.com/gca3020/weather_exporter/internal/redact"
+)
+
+// The measurements shown on each target's card, as a compact summary of its conditions. Those
+// with no unit here are shown in the unit the collector reports them in.
+var landingFields = []struct {
+	name, label, unit string
+}{
+	{"temperature", "Temperature", ""},
+	{"feelslike", "Feels like", ""},
+	{"humidity", "Humidity", "%"},
+	{"pressure_msl", "Pressure", ""},
+	{"wind_speed", "Wind", ""},
+	{"wind_dir", "Direction", "°"},
+	{"cloud_pct", "Clouds", "%"},
+	{"rain", "Rain", ""},
+	{"uv_index", "UV index", ""},
+	{"aq_index", "AQI", ""},
+}
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="60">
+<title>Weather Exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.3em 1em 0.3em 0; border-bottom: 1px solid #ddd; }
+.cards { display: flex; flex-wrap: wrap; gap: 1em; }
+.card { border: 1px solid #ccc; border-radius: 6px; padding: 1em; min-width: 14em; }
+.card h3 { margin: 0 0 0.2em 0; }
+.card dl { display: grid; grid-template-columns: auto auto; gap: 0.2em 1em; margin: 0.5em 0 0 0; }
+.card dd { margin: 0; text-align: right; }
+.meta { color: #666; font-size: 0.9em; }
+.ok { color: #2a7d2a; }
+.error { color: #b22222; }
+.pending { color: #888; }
+</style>
+</head>
+<body>
+<h1>Weather Exporter</h1>
+<p><a href="{{.MetricsPath}}">Metrics</a> &middot; <a href="{{.ConditionsPath}}">Conditions (JSON)</a></p>
+
+<h2>Targets</h2>
+{{if .Targets}}
+<table>
+<tr><th>Provider</th><th>Location</th><th>Coordinates</th><th>Health</th><th>Last poll</th><th>Error</th></tr>
+{{range .Targets}}
+<tr>
+<td>{{.Provider}}</td>
+<td>{{.Location}}</td>
+<td>{{.Coordinates}}</td>
+<td class="{{.Health}}">{{.Health}}</td>
+<td>{{.LastPoll}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{end}}
+</table>
+
+<h2>Current Conditions</h2>
+<div class="cards">
+{{range .Targets}}{{if .Fields}}
+<div class="card">
+<h3>{{if .Location}}{{.Location}}{{else}}{{.Coordinates}}{{end}}</h3>
+<div class="meta">{{.Provider}}{{if .Upstream}} via {{.Upstream}}{{end}}{{if .ObservedAt}} &middot; observed {{.ObservedAt}}{{end}}</div>
+<div>{{.Description}}</div>
+<dl>
+{{range .Fields}}<dt>{{.Label}}</dt><dd>{{.Value}}</dd>
+{{end}}</dl>
+</div>
+{{end}}{{end}}
+</div>
+{{else}}
+<p>No locations are configured.</p>
+{{end}}
+</body>
+</html>
+`))
+
+type landingPage struct {
+	MetricsPath    string
+	ConditionsPath string
+	Targets        []landingTarget
+}
+
+type landingTarget struct {
+	Provider    string
+	Location    string
+	Coordinates string
+	Upstream    string
+	Health      string // "ok", "error", or "pending" if the target has not been polled yet
+	LastPoll    string
+	ObservedAt  string
+	Error       string
+	Description string
+	Fields      []landingField
+}
+
+type landingField struct {
+	Label string
+	Value string
+}
+
+// NewLandingHandler returns an http.Handler which serves an HTML summary of every target, and its
+// current conditions, linking to the metrics and conditions endpoints at the given paths. This
+// does not poll the providers itself, so it reflects the most recent scrape.
+func NewLandingHandler(c *Collector, metricsPath string, conditionsPath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		page := landingPage{MetricsPath: metricsPath, ConditionsPath: conditionsPath}
+		now := time.Now()
+		for _, state := range c.Targets() {
+			page.Targets = append(page.Targets, newLandingTarget(state, c.units, now))
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := landingTemplate.Execute(w, page); err != nil {
+			slog.Error("Unable to write landing page", "err", err)
+		}
+	})
+}
+
+func newLandingTarget(state TargetState, units api.Units, now time.Time) landingTarget {
+	t := landingTarget{
+		Provider:    state.Target.Provider,
+		Coordinates: state.Target.Coordinates,
+		Health:      "ok",
+		LastPoll:    "never",
+	}
+	switch {
+	case state.LastPoll.IsZero():
+		t.Health = "pending"
+	case state.Err != nil:
+		t.Health = "error"
+		t.Error = redact.String(state.Err.Error())
+	}
+	if !state.LastPoll.IsZero() {
+		t.LastPoll = since(now, state.LastPoll)
+	}
+
+	if state.Conditions != nil {
+		cc := units.Convert(state.Conditions)
+		t.Location = cc.LocationName
+		t.Upstream = cc.Upstream
+		t.Description = cc.Description
+		if !cc.ObservedAt.IsZero() {
+			t.ObservedAt = since(now, cc.ObservedAt)
+		}
+		for _, lf := range landingFields {
+			for _, f := range api.Fields {
+				if f.Name != lf.name || api.IsMissing(*f.Value(cc)) {
+					continue
+				}
+				value := strconv.FormatFloat(*f.Value(cc), 'f', 1, 64)
+				unit := lf.unit
+				if u, ok := units[f.Name]; ok {
+					unit = u.Symbol
+				}
+				if unit != "" {
+					value += " " + unit
+				}
+				t.Fields = append(t.Fields, landingField{Label: lf.label, Value: value})
+			}
+		}
+	}
+	return t
+}
+
+// since formats how long ago a time was, to the nearest second
+func since(now time.Time, t time.Time) string {
+	return now.Sub(t).Round(time.Second).String() + " ago"
+}
@@ -0,0 +1,143 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Schema selects which set of metric names the collector reports
+type Schema int
+
+const (
+	// SchemaV1 is the original set of names, without units unless they differ from the defaults
+	SchemaV1 Schema = 1 << iota
+	// SchemaV2 follows the Prometheus naming conventions, with a unit in every name
+	SchemaV2
+	// SchemaBoth reports both sets of names, while dashboards and alerts are migrated
+	SchemaBoth = SchemaV1 | SchemaV2
+)
+
+func ParseSchema(s string) (Schema, error) {
+	switch strings.ToLower(s) {
+	case "v1":
+		return SchemaV1, nil
+	case "v2":
+		return SchemaV2, nil
+	case "both":
+		return SchemaBoth, nil
+	}
+	return SchemaV1, fmt.Errorf("unknown metrics schema %q, expected v1, v2 or both", s)
+}
+
+// v2Field describes how a measurement is named in the v2 schema. The unit in the name is that of
+// the measurement's reporting unit, unless the measurement has a fixed unit here.
+type v2Field struct {
+	name  string  // Name of the metric, without the unit
+	unit  string  // Unit of measurements which cannot be converted, if any
+	per   string  // Suffix following the unit, for rates
+	scale float64 // Factor applied to the measurement, such as to convert a percentage to a ratio
+	help  string  // Help text, if it differs from the v1 schema
+}
+
+var v2Fields = map[string]v2Field{
+	"temperature":      {name: "temperature"},
+	"feelslike":        {name: "apparent_temperature"},
+	"humidity":         {name: "relative_humidity", unit: "ratio", scale: 0.01, help: "The current relative humidity, from 0 to 1"},
+	"pressure_msl":     {name: "pressure_msl"},
+	"pressure_surface": {name: "pressure_surface"},
+	"visibility":       {name: "visibility"},
+	"wind_speed":       {name: "wind_speed"},
+	"wind_dir":         {name: "wind_direction", unit: "degrees"},
+	"wind_gust":        {name: "wind_gust"},
+	"cloud_pct":        {name: "cloud_cover", unit: "ratio", scale: 0.01, help: "The cloud cover, from 0 to 1"},
+	"rain":             {name: "rain", per: "_per_hour"},
+	"snow":             {name: "snow", per: "_per_hour"},
+	"uv_index":         {name: "uv_index"},
+	"aq_index":         {name: "air_quality_index"},
+	"co_conc":          {name: "co", unit: "micrograms_per_cubic_meter"},
+	"no_conc":          {name: "no", unit: "micrograms_per_cubic_meter"},
+	"no2_conc":         {name: "no2", unit: "micrograms_per_cubic_meter"},
+	"o3_conc":          {name: "o3", unit: "micrograms_per_cubic_meter"},
+	"so2_conc":         {name: "so2", unit: "micrograms_per_cubic_meter"},
+	"nh3_conc":         {name: "nh3", unit: "micrograms_per_cubic_meter"},
+	"pm2p5_conc":       {name: "pm2p5", unit: "micrograms_per_cubic_meter"},
+	"pm10_conc":        {name: "pm10", unit: "micrograms_per_cubic_meter"},
+}
+
+// gauge is the metric reported for a single measurement
+type gauge struct {
+	field api.Field
+	name  string
+	desc  *prometheus.Desc
+	scale float64 // Factor applied to the measurement, once it is in its reporting unit
+	zero  bool    // Whether a measurement the provider does not report is exported as zero, as v1 always has
+}
+
+// newGauges creates the gauges for every measurement in the given schema. Measurements are reported
+// in the given units, with the unit added to the v1 names only if it is not the default.
+func newGauges(schema Schema, units api.Units) []gauge {
+	gauges := make([]gauge, 0, 2*len(api.Fields))
+	if schema&SchemaV1 != 0 {
+		for _, f := range api.Fields {
+			name, help := f.Name, fieldHelp[f.Name]
+			if unit, ok := units[f.Name]; ok {
+				help = fmt.Sprintf(help, unit.Description)
+				if !unit.Base {
+					name += "_" + unit.Name
+				}
+			}
+			g := newGauge(f, name, help, 1)
+			g.zero = true
+			gauges = append(gauges, g)
+		}
+	}
+	if schema&SchemaV2 != 0 {
+		for _, f := range api.Fields {
+			v2 := v2Fields[f.Name]
+			name, help, scale := v2.name, fieldHelp[f.Name], 1.0
+			if unit, ok := units[f.Name]; ok {
+				help = fmt.Sprintf(help, unit.Description)
+				name += "_" + unit.Name
+			} else if v2.unit != "" {
+				name += "_" + v2.unit
+			}
+			name += v2.per
+			if v2.help != "" {
+				help = v2.help
+			}
+			if v2.scale != 0 {
+				scale = v2.scale
+			}
+			gauges = append(gauges, newGauge(f, name, help, scale))
+		}
+	}
+
+	// A measurement in a unit other than the default has the same name in both schemas (e.g.
+	// weather_temperature_fahrenheit), so is only reported once when both are
+	unique := make([]gauge, 0, len(gauges))
+	seen := make(map[string]bool, len(gauges))
+	for _, g := range gauges {
+		if !seen[g.name] {
+			unique = append(unique, g)
+			seen[g.name] = true
+		}
+	}
+	return unique
+}
+
+func newGauge(f api.Field, name string, help string, scale float64) gauge {
+	return gauge{
+		field: f,
+		name:  name,
+		desc:  prometheus.NewDesc(fqName(name), help, []string{"provider", "location", "coordinates"}, nil),
+		scale: scale,
+	}
+}
+
+// value returns the measurement reported by the gauge, from conditions already in their reporting units
+func (g *gauge) value(cc *api.CurrentConditions) float64 {
+	return *g.field.Value(cc) * g.scale
+}
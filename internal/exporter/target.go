@@ -0,0 +1,57 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gca3020/weather_exporter/internal/api"
+)
+
+// TargetState is the outcome of the most recent poll of a single provider and location
+type TargetState struct {
+	Target     api.Target
+	LastPoll   time.Time              // When the target was last polled, or zero if it has not been yet
+	Err        error                  // The error from the last poll, if it failed
+	Conditions *api.CurrentConditions // The conditions from the last successful poll, if any
+}
+
+// target tracks the state of an API between polls
+type target struct {
+	api api.WeatherApi
+
+	mu       sync.Mutex
+	lastPoll time.Time
+	err      error
+	last     *api.CurrentConditions
+}
+
+func newTargets(apis []api.WeatherApi) []*target {
+	targets := make([]*target, 0, len(apis))
+	for _, a := range apis {
+		targets = append(targets, &target{api: a})
+	}
+	return targets
+}
+
+// update records the outcome of a poll. A failed poll keeps the conditions from the last
+// successful one, so that they are still available alongside the error.
+func (t *target) update(cc *api.CurrentConditions, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastPoll = time.Now()
+	t.err = err
+	if err == nil {
+		t.last = cc
+	}
+}
+
+func (t *target) state() TargetState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return TargetState{
+		Target:     t.api.Target(),
+		LastPoll:   t.lastPoll,
+		Err:        t.err,
+		Conditions: t.last,
+	}
+}
@@ -0,0 +1,59 @@
+package redact
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	Placeholder = "REDACTED"
+
+	// Secrets shorter than this are not registered, since replacing them would mangle unrelated text
+	minSecretLen = 6
+)
+
+// Query parameters which providers use to carry API keys
+var keyParams = regexp.MustCompile(`(?i)([?&](?:appid|apikey|api_key|key|token)=)[^&\s"']*`)
+
+var (
+	mu      sync.RWMutex
+	secrets = make(map[string]struct{})
+)
+
+// Secret registers a value (such as an API key) which must never appear in logs or errors
+func Secret(value string) {
+	if len(value) < minSecretLen {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	secrets[value] = struct{}{}
+}
+
+// String replaces every registered secret, and the value of any query parameter known to carry an
+// API key, with a placeholder.
+func String(s string) string {
+	s = keyParams.ReplaceAllString(s, "${1}"+Placeholder)
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Placeholder)
+	}
+	return s
+}
+
+// Error redacts the URL held by a *url.Error anywhere in the error's chain. The error is modified
+// in place, and returned for convenience. Wrappers such as fmt.Errorf which format their message
+// when they are created have already copied the URL, so this must be called before wrapping.
+func Error(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = String(urlErr.URL)
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package redact
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"appid", "https://api.openweathermap.org/data/2.5/weather?lat=1&lon=2&appid=abc123", "https://api.openweathermap.org/data/2.5/weather?lat=1&lon=2&appid=REDACTED"},
+		{"key", "https://api.weatherapi.com/v1/current.json?q=1,2&key=abc123&aqi=yes", "https://api.weatherapi.com/v1/current.json?q=1,2&key=REDACTED&aqi=yes"},
+		{"apikey", "https://api.tomorrow.io/v4/weather/realtime?apikey=abc123", "https://api.tomorrow.io/v4/weather/realtime?apikey=REDACTED"},
+		{"case insensitive", "https://example.com/?APPID=abc123", "https://example.com/?APPID=REDACTED"},
+		{"quoted", `Get "https://example.com/?key=abc123": EOF`, `Get "https://example.com/?key=REDACTED": EOF`},
+		{"other parameters", "https://example.com/?monkey=abc123&lat=1", "https://example.com/?monkey=abc123&lat=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := String(tt.in); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStringSecrets(t *testing.T) {
+	Secret("s3cr3t-value")
+	Secret("short") // Too short to register
+
+	if got := String("Authorization: Bearer s3cr3t-value"); got != "Authorization: Bearer REDACTED" {
+		t.Errorf("expected the registered secret to be redacted, got %q", got)
+	}
+	if got := String("a short message"); got != "a short message" {
+		t.Errorf("expected a short secret not to be registered, got %q", got)
+	}
+}
+
+// wrapped formats its message only when asked, as ProviderError does
+type wrapped struct{ err error }
+
+func (w *wrapped) Error() string { return "polling: " + w.err.Error() }
+func (w *wrapped) Unwrap() error { return w.err }
+
+func TestError(t *testing.T) {
+	err := &wrapped{&url.Error{
+		Op:  http.MethodGet,
+		URL: "https://api.openweathermap.org/data/2.5/weather?appid=abc123",
+		Err: errors.New("connection refused"),
+	}}
+
+	got := Error(err).Error()
+	if strings.Contains(got, "abc123") || !strings.Contains(got, "appid=REDACTED") {
+		t.Errorf("expected the wrapped URL to be redacted, got %q", got)
+	}
+	if err := Error(errors.New("no URL here")); err.Error() != "no URL here" {
+		t.Errorf("expected an error without a URL to be unchanged, got %q", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	Secret("s3cr3t-value")
+	keyedURL := "https://api.weatherapi.com/v1/current.json?key=abc123"
+
+	tests := []struct {
+		name string
+		log  func(*slog.Logger)
+	}{
+		{"message", func(l *slog.Logger) { l.Info("token is s3cr3t-value") }},
+		{"string attribute", func(l *slog.Logger) { l.Info("polling", "url", keyedURL) }},
+		{"error attribute", func(l *slog.Logger) {
+			l.Error("polling failed", "err", &url.Error{Op: http.MethodGet, URL: keyedURL, Err: errors.New("timeout")})
+		}},
+		{"nested groups", func(l *slog.Logger) {
+			l.Info("request", slog.Group("http", slog.Group("request", slog.String("url", keyedURL))))
+		}},
+		{"logger attributes", func(l *slog.Logger) { l.With("url", keyedURL).Info("polling") }},
+		{"logger group", func(l *slog.Logger) { l.WithGroup("http").Info("polling", "url", keyedURL) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(slog.New(NewHandler(slog.NewTextHandler(&buf, nil))))
+
+			out := buf.String()
+			if strings.Contains(out, "abc123") || strings.Contains(out, "s3cr3t-value") {
+				t.Errorf("expected secrets to be redacted, got %q", out)
+			}
+			if !strings.Contains(out, Placeholder) {
+				t.Errorf("expected the placeholder in %q", out)
+			}
+		})
+	}
+}
+
+func TestHandlerEnabled(t *testing.T) {
+	h := NewHandler(slog.NewTextHandler(&bytes.Buffer{}, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	if h.Enabled(context.Background(), slog.LevelInfo) || !h.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("expected the wrapped handler's level to be respected")
+	}
+}